@@ -0,0 +1,219 @@
+package main
+
+import (
+  "fmt"
+  "os"
+  "strings"
+)
+
+// -check compares the generated code with the -output file instead of
+// writing it, so that a CI job can fail when the checked in code is out
+// of date with the schema.
+
+// report whether a line is part of the header that changes from run
+// to run, which -check ignores
+func volatileLine(line string) bool {
+  return strings.HasPrefix(line, "// GENERATED BY ") || strings.HasPrefix(line, "// ---args:")
+}
+
+// split code into lines, leaving out the volatile header before the
+// package clause
+func codeLines(code string) []string {
+  var lines []string
+  header := true
+  for _, line := range strings.SplitAfter(code, "\n") {
+    if line == "" {
+      continue
+    }
+    if strings.HasPrefix(line, "package ") {
+      header = false
+    }
+    if header && volatileLine(line) {
+      continue
+    }
+    lines = append(lines, line)
+  }
+  return lines
+}
+
+// compare the generated code with the file at path, returning a
+// unified diff turning the file into the code, or "" if they are the
+// same. A missing file differs from any code.
+func checkOutput(path string, code []byte) (string, error) {
+  old, err := os.ReadFile(path)
+  if err != nil && !os.IsNotExist(err) {
+    return "", err
+  }
+
+  return unifiedDiff(path, path+" (generated)", codeLines(string(old)), codeLines(string(code))), nil
+}
+
+// a line of an edit script: ' ' kept, '-' deleted or '+' inserted
+type diffOp struct {
+  kind byte
+  line string
+}
+
+// return the shortest edit script turning a into b, following Myers'
+// "An O(ND) Difference Algorithm and Its Variations"
+func diffLines(a, b []string) []diffOp {
+  n, m := len(a), len(b)
+
+  // e.g. a missing -output file
+  if n == 0 || m == 0 {
+    var ops []diffOp
+    for _, line := range a {
+      ops = append(ops, diffOp{'-', line})
+    }
+    for _, line := range b {
+      ops = append(ops, diffOp{'+', line})
+    }
+    return ops
+  }
+
+  max := n + m
+  off := max + 1
+  v := make([]int, 2*max+2)
+
+  // the v of each step, to walk back the path. Step d only reads the
+  // diagonals -d..d, so only those are kept.
+  var trace [][]int
+  for d := 0; d <= max; d++ {
+    trace = append(trace, append([]int(nil), v[off-d:off+d+1]...))
+    for k := -d; k <= d; k += 2 {
+      var x int
+      if k == -d || k != d && v[off+k-1] < v[off+k+1] {
+        x = v[off+k+1]
+      } else {
+        x = v[off+k-1] + 1
+      }
+      y := x - k
+      for x < n && y < m && a[x] == b[y] {
+        x++
+        y++
+      }
+      v[off+k] = x
+
+      if x >= n && y >= m {
+        return diffPath(a, b, trace)
+      }
+    }
+  }
+  return nil
+}
+
+// walk back the steps of diffLines into an edit script
+func diffPath(a, b []string, trace [][]int) []diffOp {
+  var ops []diffOp
+  x, y := len(a), len(b)
+  for d := len(trace) - 1; d > 0; d-- {
+    // v[d+k] is diagonal k
+    v := trace[d]
+    k := x - y
+
+    prevK := k - 1
+    if k == -d || k != d && v[d+k-1] < v[d+k+1] {
+      prevK = k + 1
+    }
+    prevX := v[d+prevK]
+    prevY := prevX - prevK
+
+    for x > prevX && y > prevY {
+      ops = append(ops, diffOp{' ', a[x-1]})
+      x--
+      y--
+    }
+    if prevK == k+1 {
+      ops = append(ops, diffOp{'+', b[y-1]})
+      y--
+    } else {
+      ops = append(ops, diffOp{'-', a[x-1]})
+      x--
+    }
+  }
+  for x > 0 && y > 0 {
+    ops = append(ops, diffOp{' ', a[x-1]})
+    x--
+    y--
+  }
+
+  for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+    ops[i], ops[j] = ops[j], ops[i]
+  }
+  return ops
+}
+
+// the lines of context around the changes of a unified diff
+const diffContext = 3
+
+// return the unified diff turning a into b, or "" if they are the same
+func unifiedDiff(aName, bName string, a, b []string) string {
+  ops := diffLines(a, b)
+
+  var changes []int
+  for i, op := range ops {
+    if op.kind != ' ' {
+      changes = append(changes, i)
+    }
+  }
+  if len(changes) == 0 {
+    return ""
+  }
+
+  var out strings.Builder
+  fmt.Fprintf(&out, "--- %s\n+++ %s\n", aName, bName)
+
+  // the line numbers in a and b before each op
+  aLine, bLine := make([]int, len(ops)+1), make([]int, len(ops)+1)
+  for i, op := range ops {
+    aLine[i+1], bLine[i+1] = aLine[i], bLine[i]
+    if op.kind != '+' {
+      aLine[i+1]++
+    }
+    if op.kind != '-' {
+      bLine[i+1]++
+    }
+  }
+
+  for i := 0; i < len(changes); {
+    // the changes close enough to share a hunk
+    j := i
+    for j+1 < len(changes) && changes[j+1]-changes[j] <= 2*diffContext+1 {
+      j++
+    }
+    start := changes[i] - diffContext
+    if start < 0 {
+      start = 0
+    }
+    end := changes[j] + diffContext + 1
+    if end > len(ops) {
+      end = len(ops)
+    }
+
+    fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(aLine[start], aLine[end]-aLine[start]),
+      hunkRange(bLine[start], bLine[end]-bLine[start]))
+    for _, op := range ops[start:end] {
+      out.WriteByte(op.kind)
+      out.WriteString(op.line)
+      if !strings.HasSuffix(op.line, "\n") {
+        out.WriteString("\n\\ No newline at end of file\n")
+      }
+    }
+
+    i = j + 1
+  }
+
+  return out.String()
+}
+
+// return the range of a hunk header from the 0 based line before it
+// and its length, e.g. "3,4"
+func hunkRange(line, length int) string {
+  if length == 0 {
+    return fmt.Sprintf("%d,0", line)
+  }
+  if length == 1 {
+    return fmt.Sprintf("%d", line+1)
+  }
+  return fmt.Sprintf("%d,%d", line+1, length)
+}
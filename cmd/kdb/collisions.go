@@ -0,0 +1,130 @@
+package main
+
+import (
+  "fmt"
+  "strings"
+)
+
+// the package level names of the default template
+var reservedNames = []string{"Arger", "Querier", "InsertStmts", "SelectStmts", "UpdateStmts", "DeleteStmts"}
+
+// return the package level names declared for a struct: its own, its
+// -verify schema constant and those of its -crud and -finders functions
+func (md *Metadata) declNames(strct Struct) []string {
+  name := strct.CleanName
+  names := []string{name}
+
+  if *crud {
+    names = append(names, "List"+name)
+    if !strct.View {
+      names = append(names, "Insert"+name)
+      if len(pkFields(strct)) > 0 {
+        names = append(names, "Get"+name+"ByPK", "Delete"+name)
+        if md.updateSQL(strct) != "" {
+          names = append(names, "Update"+name)
+        }
+      }
+    }
+  }
+
+  if *verify {
+    names = append(names, name+"Schema")
+  }
+
+  if *findersFlag {
+    for _, lookup := range finders(strct) {
+      if _, fn, ok := finderFunc(strct, lookup); ok {
+        names = append(names, fn)
+      }
+    }
+  }
+
+  return names
+}
+
+// make the names of the structs, their fields and their relation
+// methods unique, giving the later of clashing names a number suffix:
+// fields are told apart from each other and the Args method, structs
+// from each other and everything else declared in the package, and
+// relation methods as in relations. It returns the clashes found,
+// which with -collisions=fail are reported instead.
+func (md *Metadata) resolveNames() []string {
+  var clashes []string
+
+  for i := range md.Structs {
+    strct := &md.Structs[i]
+
+    used := map[string]string{"Args": "the Args method"}
+    for j, f := range strct.Fields {
+      name := f.CleanName
+      for n := 2; used[name] != ""; n++ {
+        name = fmt.Sprintf("%s%d", f.CleanName, n)
+      }
+      if name != f.CleanName {
+        clashes = append(clashes, fmt.Sprintf("table %s: the field %s of column %s clashes with %s; it is %s",
+          strct.Name, f.CleanName, f.Name, used[f.CleanName], name))
+        strct.Fields[j].CleanName = name
+      }
+      used[name] = "the field of column " + f.Name
+    }
+  }
+
+  used := make(map[string]string)
+  for _, name := range reservedNames {
+    used[name] = "the generated " + name
+  }
+  if *verify {
+    used["VerifySchema"] = "the generated VerifySchema"
+  }
+  for i := range md.Structs {
+    strct := &md.Structs[i]
+    base := strct.CleanName
+
+    // the first clash of the names with base, for the report
+    var clash string
+    for _, name := range md.declNames(*strct) {
+      if used[name] != "" {
+        clash = fmt.Sprintf("%s clashes with %s", name, used[name])
+        break
+      }
+    }
+
+    for n := 2; ; n++ {
+      free := true
+      for _, name := range md.declNames(*strct) {
+        if used[name] != "" {
+          free = false
+          break
+        }
+      }
+      if free {
+        break
+      }
+      strct.CleanName = fmt.Sprintf("%s%d", base, n)
+    }
+
+    if strct.CleanName != base {
+      clashes = append(clashes, fmt.Sprintf("table %s: %s; the struct is %s", strct.Name, clash, strct.CleanName))
+    }
+    for _, name := range md.declNames(*strct) {
+      used[name] = "the struct of table " + strct.Name
+      if name != strct.CleanName {
+        used[name] = name + " of table " + strct.Name
+      }
+    }
+  }
+
+  if *relations {
+    for _, strct := range md.Structs {
+      _, relClashes := md.relations(strct)
+      clashes = append(clashes, relClashes...)
+    }
+  }
+
+  return clashes
+}
+
+// report the clashes of resolveNames
+func collisionReport(clashes []string) string {
+  return "name collisions:\n  " + strings.Join(clashes, "\n  ")
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+  goflag "flag"
+  "fmt"
+  "gopkg.in/yaml.v3"
+  "os"
+  "strconv"
+  "strings"
+)
+
+// Config is the file given to -config, in YAML (or JSON, which is
+// YAML too). Flags given on the command line override it.
+// Usage:
+//  driver: mysql
+//  dsn: user:pass@tcp(localhost:3306)/db?parseTime=true
+//  package: model
+//  output: model/model.go
+//  naming:
+//    struct: capitalize,nounderscore
+//    field: lowercase,capitalize,nounderscore
+//    initialisms: [ID, URL, API]
+//  types: auto
+//  crud: true
+//  tags: [db, "json:camel"]
+//  omitempty: true
+//  schemas: [public]
+//  tables: [users, order_*]
+//  exclude: [audit_*]
+//  views: ["/^active_/"]
+//  typemap:
+//    decimal: string
+//    users.balance: github.com/shopspring/decimal.Decimal
+//  names:
+//    users: Account
+//    users.type: Kind
+type Config struct {
+  Driver  string `yaml:"driver"`
+  DSN     string `yaml:"dsn"`
+  DDL     string `yaml:"ddl"` // as -ddl, read instead of the dsn
+  Package string `yaml:"package"`
+  Output  string `yaml:"output"`
+
+  // the directory of kdb migrate, as its -dir
+  Migrations string `yaml:"migrations"`
+
+  Naming struct {
+    Struct      string   `yaml:"struct"`
+    Field       string   `yaml:"field"`
+    Initialisms []string `yaml:"initialisms"`
+  } `yaml:"naming"`
+
+  Types    string `yaml:"types"`
+  NullType string `yaml:"nulltype"`
+  NullTime string `yaml:"nulltime"`
+  Template string `yaml:"template"`
+
+  Collisions string `yaml:"collisions"`
+
+  Crud      *bool `yaml:"crud"`
+  Finders   *bool `yaml:"finders"`
+  Relations *bool `yaml:"relations"`
+  OmitGen   *bool `yaml:"omitgen"`
+  Verify    *bool `yaml:"verify"`
+
+  // the struct tags to output, as -tags
+  Tags      []string `yaml:"tags"`
+  OmitEmpty *bool    `yaml:"omitempty"`
+
+  // as the flags of the same names; an empty views list means none
+  Schemas  []string `yaml:"schemas"`
+  Tables   []string `yaml:"tables"`
+  Exclude  []string `yaml:"exclude"`
+  Views    []string `yaml:"views"`
+  Matviews []string `yaml:"matviews"`
+
+  // Go types keyed by SQL type (e.g. "decimal" or "varchar(255)") or
+  // by table.column, which wins. A type from another package is
+  // written with its import path, e.g. "database/sql.NullString".
+  TypeMap map[string]string `yaml:"typemap"`
+
+  // struct names keyed by table and field names keyed by table.column
+  Names map[string]string `yaml:"names"`
+}
+
+// the configuration from -config, if any
+var config Config
+
+// read the config file
+func loadConfig(file string) (Config, error) {
+  var c Config
+
+  f, err := os.Open(file)
+  if err != nil {
+    return c, err
+  }
+  defer f.Close()
+
+  dec := yaml.NewDecoder(f)
+  dec.KnownFields(true)
+  err = dec.Decode(&c)
+  if err != nil {
+    return c, fmt.Errorf("%s: %v", file, err)
+  }
+
+  return c, nil
+}
+
+// return the names of the flags given on the command line
+func setFlags() map[string]bool {
+  set := make(map[string]bool)
+  flag.Visit(func(f *goflag.Flag) {
+    set[f.Name] = true
+  })
+  return set
+}
+
+// set the flags from the config, except for those in set
+func (c Config) applyFlags(set map[string]bool) error {
+  values := map[string]string{
+    "package":    c.Package,
+    "output":     c.Output,
+    "structname": c.Naming.Struct,
+    "fieldname":  c.Naming.Field,
+    "types":      c.Types,
+    "nulltype":   c.NullType,
+    "nulltime":   c.NullTime,
+    "template":   c.Template,
+    "collisions": c.Collisions,
+    "ddl":        c.DDL,
+
+    "initialisms": strings.Join(c.Naming.Initialisms, ","),
+  }
+  for name, b := range map[string]*bool{
+    "crud":      c.Crud,
+    "finders":   c.Finders,
+    "relations": c.Relations,
+    "omitgen":   c.OmitGen,
+    "verify":    c.Verify,
+    "omitempty": c.OmitEmpty,
+  } {
+    if b != nil {
+      values[name] = strconv.FormatBool(*b)
+    }
+  }
+  if len(c.Tags) > 0 {
+    values["tags"] = strings.Join(c.Tags, ",")
+  }
+
+  for name, value := range values {
+    if value == "" || set[name] {
+      continue
+    }
+    err := flag.Set(name, value)
+    if err != nil {
+      return fmt.Errorf("config %s: %v", name, err)
+    }
+  }
+
+  // each pattern is set on its own so regular expressions can hold
+  // commas; a present but empty list still sets the flag
+  for name, list := range map[string][]string{
+    "schema":   c.Schemas,
+    "tables":   c.Tables,
+    "exclude":  c.Exclude,
+    "views":    c.Views,
+    "matviews": c.Matviews,
+  } {
+    if list == nil || set[name] {
+      continue
+    }
+    if len(list) == 0 {
+      list = []string{""}
+    }
+    for _, value := range list {
+      err := flag.Set(name, value)
+      if err != nil {
+        return fmt.Errorf("config %s: %v", name, err)
+      }
+    }
+  }
+
+  return nil
+}
+
+// return the Go type the config maps a field to, or "". tables are
+// the names of the field's table.
+func (c Config) goType(tables []string, field Field) string {
+  for _, table := range tables {
+    if typ, ok := c.TypeMap[table+"."+field.Name]; ok {
+      return typ
+    }
+  }
+
+  sqlType := strings.ToLower(field.SQLType)
+  if typ, ok := c.TypeMap[sqlType]; ok {
+    return typ
+  }
+  // "decimal" for "decimal(10,2)" and "int" for "int(10) unsigned"
+  if i := strings.IndexAny(sqlType, "( "); i > 0 {
+    if typ, ok := c.TypeMap[sqlType[:i]]; ok {
+      return typ
+    }
+  }
+
+  return ""
+}
+
+// apply the names and types of the config to the introspected
+// structs. Tables may be named by schema.table too.
+func (c Config) apply(md *Metadata) {
+  for i := range md.Structs {
+    strct := &md.Structs[i]
+    for _, table := range strct.names() {
+      if name, ok := c.Names[table]; ok {
+        strct.CleanName = name
+        break
+      }
+    }
+
+    for j, field := range strct.Fields {
+      for _, table := range strct.names() {
+        if name, ok := c.Names[table+"."+field.Name]; ok {
+          strct.Fields[j].CleanName = name
+          break
+        }
+      }
+      strct.Fields[j].GoType = c.goType(strct.names(), field)
+    }
+  }
+}
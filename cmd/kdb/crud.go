@@ -0,0 +1,296 @@
+package main
+
+import (
+  "fmt"
+  "go/token"
+  "strings"
+  "unicode"
+  "unicode/utf8"
+)
+
+// return a parameter name for a field that doesn't clash with
+// keywords or the names used inside the generated functions
+func paramName(cleanName string) string {
+  r, n := utf8.DecodeRuneInString(cleanName)
+  name := string(unicode.ToLower(r)) + cleanName[n:]
+
+  // "id" for ID and "urlPath" for URLPath
+  if words := splitWords(cleanName); len(words) > 0 && len(words[0]) > 1 && words[0] == strings.ToUpper(words[0]) {
+    name = strings.ToLower(words[0]) + cleanName[len(words[0]):]
+  }
+  switch {
+  case token.IsKeyword(name), name == "ctx", name == "q", name == "t", name == "err",
+    name == "r", name == "rs", name == "rows":
+    name += "_"
+  }
+  return name
+}
+
+// return the fields of the struct that are part of the primary key
+func pkFields(strct Struct) []Field {
+  var fields []Field
+  for _, name := range strct.PrimaryKey {
+    for _, f := range strct.Fields {
+      if f.Name == name {
+        fields = append(fields, f)
+      }
+    }
+  }
+  return fields
+}
+
+// build "a = ? AND b = ?" (joined by sep) for the fields, numbering
+// placeholders from n
+func (md *Metadata) assignments(fields []Field, sep string, n int) string {
+  var parts []string
+  for _, f := range fields {
+    parts = append(parts, md.quote(f.Name)+" = "+md.placeholder(n))
+    n++
+  }
+  return strings.Join(parts, sep)
+}
+
+// isInteger reports whether typ is a plain Go integer type
+func isInteger(typ string) bool {
+  switch typ {
+  case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64":
+    return true
+  }
+  return false
+}
+
+// return the "SELECT <columns> FROM <table>" statement for a struct
+func (md *Metadata) selectSQL(strct Struct) string {
+  var cols []string
+  for _, f := range strct.Fields {
+    cols = append(cols, md.quote(f.Name))
+  }
+  return fmt.Sprintf("SELECT %s FROM %s", strings.Join(cols, ", "), md.table(strct))
+}
+
+// return the "INSERT INTO <table> (<columns>) VALUES (<placeholders>)"
+// statement for the fields
+func (md *Metadata) insertSQL(strct Struct, fields []Field) string {
+  table := md.table(strct)
+  if len(fields) == 0 {
+    if md.Dialect == "mysql" {
+      return fmt.Sprintf("INSERT INTO %s () VALUES ()", table)
+    }
+    return fmt.Sprintf("INSERT INTO %s DEFAULT VALUES", table)
+  }
+
+  var cols, phs []string
+  for n, f := range fields {
+    cols = append(cols, md.quote(f.Name))
+    phs = append(phs, md.placeholder(n+1))
+  }
+  return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, strings.Join(cols, ", "), strings.Join(phs, ", "))
+}
+
+// return the fields of the struct that are not part of the primary key
+func nonPkFields(strct Struct) []Field {
+  var fields []Field
+  for _, f := range strct.Fields {
+    if !f.PrimaryKey {
+      fields = append(fields, f)
+    }
+  }
+  return fields
+}
+
+// return the "UPDATE <table> SET <columns> WHERE <primary key>"
+// statement for the struct, or "" if it has nothing to update by or
+// to set. The placeholders are for the non primary key fields followed
+// by the primary key fields.
+func (md *Metadata) updateSQL(strct Struct) string {
+  pks := pkFields(strct)
+  sets := nonPkFields(strct)
+  if strct.View || len(pks) == 0 || len(sets) == 0 {
+    return ""
+  }
+  return fmt.Sprintf("UPDATE %s SET %s WHERE %s", md.table(strct), md.assignments(sets, ", ", 1), md.assignments(pks, " AND ", len(sets)+1))
+}
+
+// return the "DELETE FROM <table> WHERE <primary key>" statement for
+// the struct, or "" if it has no primary key
+func (md *Metadata) deleteSQL(strct Struct) string {
+  pks := pkFields(strct)
+  if strct.View || len(pks) == 0 {
+    return ""
+  }
+  return fmt.Sprintf("DELETE FROM %s WHERE %s", md.table(strct), md.assignments(pks, " AND ", 1))
+}
+
+// return the parameters and arguments of a function taking fields
+func (md *Metadata) params(fields []Field) (params, args []string) {
+  for _, f := range fields {
+    params = append(params, ", "+paramName(f.CleanName)+" "+md.goType(f))
+    args = append(args, ", "+paramName(f.CleanName))
+  }
+  return
+}
+
+// append a function returning the rows of query scanned into structs.
+// fn may include a receiver, e.g. "(t *Users) Orders".
+func (code *Code) listFunc(doc, fn, typ, query string, params, args []string) {
+  code.Appendf(`// %[1]s
+func %[2]s(ctx context.Context, q Querier%[3]s) ([]%[4]s, error) {
+  rows, err := q.QueryContext(ctx, %[5]q%[6]s)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  var rs []%[4]s
+  for rows.Next() {
+    var r %[4]s
+    if err := rows.Scan(r.Args()...); err != nil {
+      return nil, err
+    }
+    rs = append(rs, r)
+  }
+
+  return rs, rows.Err()
+}
+`, doc, fn, strings.Join(params, ""), typ, query, strings.Join(args, ""))
+}
+
+// append a function returning the single row of query scanned into
+// a struct. fn may include a receiver, e.g. "(t *Orders) Users".
+func (code *Code) getFunc(doc, fn, typ, query string, params, args []string) {
+  code.Appendf(`// %[1]s
+// It returns sql.ErrNoRows if there is no such row.
+func %[2]s(ctx context.Context, q Querier%[3]s) (*%[4]s, error) {
+  var r %[4]s
+  err := q.QueryRowContext(ctx, %[5]q%[6]s).Scan(r.Args()...)
+  if err != nil {
+    return nil, err
+  }
+  return &r, nil
+}
+`, doc, fn, strings.Join(params, ""), typ, query, strings.Join(args, ""))
+}
+
+// create Get<name>ByPK, Insert<name>, Update<name>, Delete<name> and
+// List<name> for a table. Tables without a primary key only get
+// Insert and List, views only get List.
+func (md *Metadata) createCrud(strct Struct) {
+  md.Imports["context"] = true
+  md.Imports["database/sql"] = true
+
+  name := strct.CleanName
+  selectSQL := md.selectSQL(strct)
+
+  pks := pkFields(strct)
+  if strct.View {
+    pks = nil
+  }
+
+  params, pkArgs := md.params(pks)
+  where := md.assignments(pks, " AND ", 1)
+
+  // List<name>
+  listSQL := selectSQL
+  if len(pks) > 0 {
+    var order []string
+    for _, f := range pks {
+      order = append(order, md.quote(f.Name))
+    }
+    listSQL += " ORDER BY " + strings.Join(order, ", ")
+  }
+  md.CrudCode.listFunc(
+    fmt.Sprintf("List%s returns all the rows of %s.", name, strct.Name),
+    "List"+name, name, listSQL, nil, nil)
+
+  if strct.View {
+    return
+  }
+
+  // Insert<name>
+  var auto *Field
+  var insertFields []Field
+  var insertArgs []string
+  for i, f := range strct.Fields {
+    if f.AutoIncrement && auto == nil {
+      auto = &strct.Fields[i]
+      continue
+    }
+    insertFields = append(insertFields, f)
+    insertArgs = append(insertArgs, ", t."+f.CleanName)
+  }
+  insertSQL := md.insertSQL(strct, insertFields)
+
+  md.CrudCode.Appendf("// Insert%s inserts t into %s", name, strct.Name)
+  switch {
+  case auto == nil:
+    md.CrudCode.Appendf(`.
+func Insert%s(ctx context.Context, q Querier, t *%s) error {
+  _, err := q.ExecContext(ctx, %q%s)
+  return err
+}
+`, name, name, insertSQL, strings.Join(insertArgs, ""))
+  case md.Dialect == "postgresql":
+    md.CrudCode.Appendf(` and sets t.%[1]s.
+func Insert%[2]s(ctx context.Context, q Querier, t *%[2]s) error {
+  return q.QueryRowContext(ctx, %[3]q%[4]s).Scan(&t.%[1]s)
+}
+`, auto.CleanName, name, insertSQL+" RETURNING "+md.quote(auto.Name), strings.Join(insertArgs, ""))
+  default:
+    // the field is an integer, a pointer to one, or a nullable
+    // type implementing sql.Scanner
+    var set string
+    switch typ := md.goType(*auto); {
+    case isInteger(typ):
+      set = fmt.Sprintf("t.%s = %s(id)\nreturn nil", auto.CleanName, typ)
+    case strings.HasPrefix(typ, "*") && isInteger(typ[1:]):
+      set = fmt.Sprintf("v := %s(id)\nt.%s = &v\nreturn nil", typ[1:], auto.CleanName)
+    default:
+      set = fmt.Sprintf("return t.%s.Scan(id)", auto.CleanName)
+    }
+    md.CrudCode.Appendf(` and sets t.%[1]s.
+func Insert%[2]s(ctx context.Context, q Querier, t *%[2]s) error {
+  res, err := q.ExecContext(ctx, %[3]q%[4]s)
+  if err != nil {
+    return err
+  }
+
+  id, err := res.LastInsertId()
+  if err != nil {
+    return err
+  }
+  %[5]s
+}
+`, auto.CleanName, name, insertSQL, strings.Join(insertArgs, ""), set)
+  }
+
+  if len(pks) == 0 {
+    return
+  }
+
+  // Get<name>ByPK
+  md.CrudCode.getFunc(
+    fmt.Sprintf("Get%sByPK returns the row of %s with the given primary key.", name, strct.Name),
+    "Get"+name+"ByPK", name, selectSQL+" WHERE "+where, params, pkArgs)
+
+  // Update<name>
+  if updateSQL := md.updateSQL(strct); updateSQL != "" {
+    var setArgs []string
+    for _, f := range append(nonPkFields(strct), pks...) {
+      setArgs = append(setArgs, ", t."+f.CleanName)
+    }
+    md.CrudCode.Appendf(`// Update%[1]s updates the row of %[2]s with t's primary key.
+func Update%[1]s(ctx context.Context, q Querier, t *%[1]s) error {
+  _, err := q.ExecContext(ctx, %[3]q%[4]s)
+  return err
+}
+`, name, strct.Name, updateSQL, strings.Join(setArgs, ""))
+  }
+
+  // Delete<name>
+  md.CrudCode.Appendf(`// Delete%[1]s deletes the row of %[2]s with the given primary key.
+func Delete%[1]s(ctx context.Context, q Querier%[3]s) error {
+  _, err := q.ExecContext(ctx, %[4]q%[5]s)
+  return err
+}
+`, name, strct.Name, strings.Join(params, ""), md.deleteSQL(strct), strings.Join(pkArgs, ""))
+}
@@ -0,0 +1,2107 @@
+package main
+
+import (
+  "database/sql"
+  "fmt"
+  "os"
+  "path/filepath"
+  "sort"
+  "strings"
+)
+
+// -ddl reads the schema from SQL files instead of a live database.
+// sqlite3 files are run against an in memory database, which is then
+// introspected as usual. mysql and postgresql files are parsed: CREATE
+// TABLE, ALTER TABLE, CREATE INDEX, DROP TABLE, DROP INDEX, RENAME
+// TABLE and COMMENT ON are applied in order and every other statement
+// (views, functions, grants, ...) is ignored. The result is what the
+// live introspection of the same dialect reads after running them.
+
+// return the files of path: path itself, or the *.sql files of the
+// directory in name order, leaving out *.down.sql migrations
+func ddlFiles(path string) ([]string, error) {
+  fi, err := os.Stat(path)
+  if err != nil {
+    return nil, err
+  }
+  if !fi.IsDir() {
+    return []string{path}, nil
+  }
+
+  files, err := filepath.Glob(filepath.Join(path, "*.sql"))
+  if err != nil {
+    return nil, err
+  }
+
+  var ret []string
+  for _, file := range files {
+    if !strings.HasSuffix(file, ".down.sql") {
+      ret = append(ret, file)
+    }
+  }
+  sort.Strings(ret)
+
+  if len(ret) == 0 {
+    return nil, fmt.Errorf("no *.sql files in %s", path)
+  }
+  return ret, nil
+}
+
+// read the structs of the DDL files at path into md
+func ddl(md *Metadata, path string) error {
+  files, err := ddlFiles(path)
+  if err != nil {
+    return err
+  }
+
+  if md.Dialect == "sqlite3" {
+    return sqlite3DDL(md, files)
+  }
+
+  schema := newDDLSchema(md.Dialect)
+  for _, file := range files {
+    src, err := os.ReadFile(file)
+    if err != nil {
+      return err
+    }
+    err = schema.exec(string(src))
+    if err != nil {
+      return fmt.Errorf("%s: %v", file, err)
+    }
+  }
+
+  switch md.Dialect {
+  case "mysql":
+    schema.mysql(md)
+  case "postgresql":
+    schema.postgresql(md)
+  default:
+    return fmt.Errorf("-ddl does not support %s", md.Dialect)
+  }
+  return nil
+}
+
+// run the files against an in memory sqlite3 database and introspect it
+func sqlite3DDL(md *Metadata, files []string) error {
+  db, err := sql.Open("sqlite3", ":memory:")
+  if err != nil {
+    return err
+  }
+  defer db.Close()
+
+  // every connection would get its own database
+  db.SetMaxOpenConns(1)
+
+  for _, file := range files {
+    src, err := os.ReadFile(file)
+    if err != nil {
+      return err
+    }
+    _, err = db.Exec(string(src))
+    if err != nil {
+      return fmt.Errorf("%s: %v", file, err)
+    }
+  }
+
+  return sqlite3(md, db)
+}
+
+// the kinds of tokens
+const (
+  tokWord   = 'w' // a bare word: keyword or identifier
+  tokIdent  = 'i' // a quoted identifier
+  tokString = 's' // a string literal, unquoted
+  tokNumber = 'n'
+  tokPunct  = 'p' // anything else, e.g. "(", "," or "::"
+)
+
+type ddlToken struct {
+  kind byte
+  text string
+}
+
+// report whether the token is the bare word (any case)
+func (t ddlToken) is(word string) bool {
+  return t.kind == tokWord && strings.EqualFold(t.text, word)
+}
+
+// split src into statements of tokens. Comments are dropped.
+func lexDDL(src, dialect string) ([][]ddlToken, error) {
+  var stmts [][]ddlToken
+  var stmt []ddlToken
+
+  isWord := func(c byte) bool {
+    return c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+  }
+
+  for i := 0; i < len(src); {
+    c := src[i]
+    switch {
+    case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+      i++
+
+    case strings.HasPrefix(src[i:], "--") || c == '#' && dialect == "mysql":
+      for i < len(src) && src[i] != '\n' {
+        i++
+      }
+
+    case strings.HasPrefix(src[i:], "/*"):
+      end := strings.Index(src[i+2:], "*/")
+      if end < 0 {
+        return nil, fmt.Errorf("unterminated comment")
+      }
+      i += end + 4
+
+    case c == ';':
+      if len(stmt) > 0 {
+        stmts = append(stmts, stmt)
+      }
+      stmt = nil
+      i++
+
+    case c == '\'' || c == '"' && dialect == "mysql" ||
+      (c == 'E' || c == 'e') && i+1 < len(src) && src[i+1] == '\'' && dialect == "postgresql":
+      // backslash escapes in mysql strings and postgresql E'' strings
+      escapes := dialect == "mysql"
+      if c != '\'' && c != '"' {
+        escapes = true
+        i++
+        c = src[i]
+      }
+
+      var b strings.Builder
+      j := i + 1
+      for ; j < len(src); j++ {
+        if escapes && src[j] == '\\' && j+1 < len(src) {
+          j++
+          switch src[j] {
+          case 'n':
+            b.WriteByte('\n')
+          case 't':
+            b.WriteByte('\t')
+          case 'r':
+            b.WriteByte('\r')
+          case '0':
+            b.WriteByte(0)
+          default:
+            b.WriteByte(src[j])
+          }
+          continue
+        }
+        if src[j] == c {
+          if j+1 < len(src) && src[j+1] == c {
+            b.WriteByte(c)
+            j++
+            continue
+          }
+          break
+        }
+        b.WriteByte(src[j])
+      }
+      if j >= len(src) {
+        return nil, fmt.Errorf("unterminated string")
+      }
+      stmt = append(stmt, ddlToken{tokString, b.String()})
+      i = j + 1
+
+    case c == '"' || c == '`' || c == '[' && dialect == "sqlite3":
+      end := c
+      if c == '[' {
+        end = ']'
+      }
+
+      var b strings.Builder
+      j := i + 1
+      for ; j < len(src); j++ {
+        if src[j] == end {
+          if j+1 < len(src) && src[j+1] == end && end != ']' {
+            b.WriteByte(end)
+            j++
+            continue
+          }
+          break
+        }
+        b.WriteByte(src[j])
+      }
+      if j >= len(src) {
+        return nil, fmt.Errorf("unterminated identifier")
+      }
+      stmt = append(stmt, ddlToken{tokIdent, b.String()})
+      i = j + 1
+
+    case c == '$' && dialect == "postgresql" && i+1 < len(src) && (src[i+1] == '$' || isWord(src[i+1]) && src[i+1] != '$'):
+      // a dollar quoted string, e.g. $$...$$ or $body$...$body$
+      tagEnd := strings.IndexByte(src[i+1:], '$')
+      if tagEnd < 0 {
+        return nil, fmt.Errorf("unterminated dollar quote")
+      }
+      tag := src[i : i+tagEnd+2]
+      end := strings.Index(src[i+len(tag):], tag)
+      if end < 0 {
+        return nil, fmt.Errorf("unterminated dollar quote %s", tag)
+      }
+      stmt = append(stmt, ddlToken{tokString, src[i+len(tag) : i+len(tag)+end]})
+      i += len(tag) + end + len(tag)
+
+    case c >= '0' && c <= '9' || c == '.' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9':
+      j := i
+      for j < len(src) && (src[j] >= '0' && src[j] <= '9' || src[j] == '.' ||
+        (src[j] == 'e' || src[j] == 'E') && j+1 < len(src) && (src[j+1] >= '0' && src[j+1] <= '9' || src[j+1] == '-' || src[j+1] == '+')) {
+        if src[j] == 'e' || src[j] == 'E' {
+          j++
+        }
+        j++
+      }
+      stmt = append(stmt, ddlToken{tokNumber, src[i:j]})
+      i = j
+
+    case isWord(c):
+      j := i
+      for j < len(src) && isWord(src[j]) {
+        j++
+      }
+      stmt = append(stmt, ddlToken{tokWord, src[i:j]})
+      i = j
+
+    case strings.HasPrefix(src[i:], "::"):
+      stmt = append(stmt, ddlToken{tokPunct, "::"})
+      i += 2
+
+    default:
+      stmt = append(stmt, ddlToken{tokPunct, string(c)})
+      i++
+    }
+  }
+
+  if len(stmt) > 0 {
+    stmts = append(stmts, stmt)
+  }
+  return stmts, nil
+}
+
+// return the SQL text of tokens, e.g. a default expression
+func tokensText(toks []ddlToken) string {
+  var b strings.Builder
+  for i, t := range toks {
+    if i > 0 {
+      prev := toks[i-1]
+      space := true
+      switch {
+      case prev.text == "(" && prev.kind == tokPunct, prev.text == "." && prev.kind == tokPunct,
+        prev.text == "::" && prev.kind == tokPunct:
+        space = false
+      case t.kind == tokPunct && (t.text == ")" || t.text == "," || t.text == "." || t.text == "::"):
+        space = false
+      case t.kind == tokPunct && t.text == "(" && (prev.kind == tokWord || prev.kind == tokIdent):
+        space = false
+      case prev.kind == tokPunct && prev.text == "-" && t.kind == tokNumber && (i == 1 || toks[i-2].kind == tokPunct):
+        space = false
+      }
+      if space {
+        b.WriteByte(' ')
+      }
+    }
+
+    switch t.kind {
+    case tokString:
+      b.WriteString("'" + strings.Replace(t.text, "'", "''", -1) + "'")
+    default:
+      b.WriteString(t.text)
+    }
+  }
+  return b.String()
+}
+
+// a column as declared
+type ddlColumn struct {
+  name     string
+  typ      ddlType
+  notNull  bool
+  def      []ddlToken // the default expression, if any
+  autoinc  bool       // AUTO_INCREMENT, serial or an identity
+  identity bool
+  sequence string // postgresql: the sequence of a serial column
+  comment  string
+}
+
+// stop a serial column from using its sequence, as a new default does
+func (col *ddlColumn) dropSequence() {
+  if col.sequence != "" {
+    col.sequence, col.autoinc = "", false
+  }
+}
+
+// a column type as declared, e.g. "numeric" with params "10" and "2"
+type ddlType struct {
+  name     string // lower case, e.g. "double precision"
+  params   []string
+  unsigned bool
+  zerofill bool
+  timeZone string // "with" or "without" for time and timestamp
+  array    int    // the number of [] following it
+}
+
+type ddlIndex struct {
+  name    string
+  columns []string // "" for expressions
+  unique  bool
+  primary bool
+}
+
+type ddlForeignKey struct {
+  name       string
+  columns    []string
+  refSchema  string
+  refTable   string
+  refColumns []string // empty for the primary key
+  index      string   // mysql: the name of an index created for it
+  onUpdate   string
+  onDelete   string
+}
+
+type ddlTable struct {
+  schema  string
+  name    string
+  comment string
+  columns []*ddlColumn
+  pk      []string
+  pkName  string
+  indexes []ddlIndex
+  fks     []ddlForeignKey
+}
+
+// return the column named name, or nil
+func (t *ddlTable) column(name string) *ddlColumn {
+  for _, col := range t.columns {
+    if col.name == name {
+      return col
+    }
+  }
+  return nil
+}
+
+// the tables the statements create, in the order they are created
+type ddlSchema struct {
+  dialect string
+  tables  []*ddlTable
+}
+
+func newDDLSchema(dialect string) *ddlSchema {
+  return &ddlSchema{dialect: dialect}
+}
+
+// return the schema of an unqualified name
+func (s *ddlSchema) defaultSchema() string {
+  if s.dialect == "postgresql" {
+    return "public"
+  }
+  if len(schemas) > 0 {
+    return schemas[0]
+  }
+  return ""
+}
+
+// return the table, or nil
+func (s *ddlSchema) table(schema, name string) *ddlTable {
+  for _, t := range s.tables {
+    if t.schema == schema && t.name == name {
+      return t
+    }
+  }
+  return nil
+}
+
+// run the statements of src
+func (s *ddlSchema) exec(src string) error {
+  stmts, err := lexDDL(src, s.dialect)
+  if err != nil {
+    return err
+  }
+
+  for _, stmt := range stmts {
+    p := &ddlParser{schema: s, toks: stmt}
+    err = p.statement()
+    if err != nil {
+      return fmt.Errorf("%v in: %s", err, oneLine(tokensText(stmt)))
+    }
+  }
+  return nil
+}
+
+// parses one statement
+type ddlParser struct {
+  schema *ddlSchema
+  toks   []ddlToken
+  pos    int
+}
+
+func (p *ddlParser) peek() ddlToken {
+  if p.pos < len(p.toks) {
+    return p.toks[p.pos]
+  }
+  return ddlToken{}
+}
+
+func (p *ddlParser) next() ddlToken {
+  t := p.peek()
+  if p.pos < len(p.toks) {
+    p.pos++
+  }
+  return t
+}
+
+func (p *ddlParser) done() bool {
+  return p.pos >= len(p.toks)
+}
+
+// report whether the next tokens are the words
+func (p *ddlParser) is(words ...string) bool {
+  for i, word := range words {
+    if p.pos+i >= len(p.toks) || !p.toks[p.pos+i].is(word) {
+      return false
+    }
+  }
+  return true
+}
+
+// consume the words if they are next
+func (p *ddlParser) accept(words ...string) bool {
+  if !p.is(words...) {
+    return false
+  }
+  p.pos += len(words)
+  return true
+}
+
+// report whether the next token is the punctuation
+func (p *ddlParser) isPunct(punct string) bool {
+  t := p.peek()
+  return t.kind == tokPunct && t.text == punct
+}
+
+func (p *ddlParser) expectPunct(punct string) error {
+  if !p.isPunct(punct) {
+    return fmt.Errorf("expected %q, found %q", punct, p.peek().text)
+  }
+  p.pos++
+  return nil
+}
+
+// return an identifier. postgresql folds unquoted ones to lower case.
+func (p *ddlParser) ident() (string, error) {
+  t := p.next()
+  switch t.kind {
+  case tokIdent:
+    return t.text, nil
+  case tokWord:
+    if p.schema.dialect == "postgresql" {
+      return strings.ToLower(t.text), nil
+    }
+    return t.text, nil
+  case tokString:
+    // mysql allows quoting some names as strings
+    if p.schema.dialect == "mysql" {
+      return t.text, nil
+    }
+  }
+  return "", fmt.Errorf("expected a name, found %q", t.text)
+}
+
+// return a possibly schema qualified name
+func (p *ddlParser) qualifiedName() (schema, name string, err error) {
+  name, err = p.ident()
+  if err != nil {
+    return
+  }
+  if p.isPunct(".") {
+    p.pos++
+    schema = name
+    name, err = p.ident()
+    return
+  }
+  return p.schema.defaultSchema(), name, nil
+}
+
+// consume a balanced parenthesized group and return what is inside
+func (p *ddlParser) group() ([]ddlToken, error) {
+  if err := p.expectPunct("("); err != nil {
+    return nil, err
+  }
+  start := p.pos
+  depth := 1
+  for !p.done() {
+    t := p.next()
+    if t.kind != tokPunct {
+      continue
+    }
+    switch t.text {
+    case "(":
+      depth++
+    case ")":
+      depth--
+      if depth == 0 {
+        return p.toks[start : p.pos-1], nil
+      }
+    }
+  }
+  return nil, fmt.Errorf("unbalanced parentheses")
+}
+
+// split tokens at the commas outside parentheses
+func splitCommas(toks []ddlToken) [][]ddlToken {
+  var parts [][]ddlToken
+  depth, start := 0, 0
+  for i, t := range toks {
+    if t.kind != tokPunct {
+      continue
+    }
+    switch t.text {
+    case "(":
+      depth++
+    case ")":
+      depth--
+    case ",":
+      if depth == 0 {
+        parts = append(parts, toks[start:i])
+        start = i + 1
+      }
+    }
+  }
+  if start < len(toks) {
+    parts = append(parts, toks[start:])
+  }
+  return parts
+}
+
+// skip to the next comma outside parentheses, or the end
+func (p *ddlParser) skipItem() {
+  depth := 0
+  for !p.done() {
+    t := p.peek()
+    if t.kind == tokPunct {
+      switch {
+      case t.text == "(":
+        depth++
+      case t.text == ")":
+        depth--
+      case t.text == "," && depth == 0:
+        return
+      }
+    }
+    p.pos++
+  }
+}
+
+// parse the column list of an index or key: names, with a mysql
+// prefix length or an order, or expressions which are ""
+func (p *ddlParser) indexColumns() ([]string, error) {
+  toks, err := p.group()
+  if err != nil {
+    return nil, err
+  }
+
+  var cols []string
+  for _, part := range splitCommas(toks) {
+    if len(part) == 0 {
+      continue
+    }
+    sub := &ddlParser{schema: p.schema, toks: part}
+    first := part[0]
+    isName := first.kind == tokIdent || first.kind == tokWord
+    if isName && len(part) > 1 && part[1].kind == tokPunct && part[1].text == "(" {
+      // a prefix length, e.g. name(10), or a function call
+      isName = len(part) > 2 && part[2].kind == tokNumber
+    }
+    if !isName {
+      cols = append(cols, "")
+      continue
+    }
+    name, err := sub.ident()
+    if err != nil {
+      return nil, err
+    }
+    cols = append(cols, name)
+  }
+  return cols, nil
+}
+
+// parse a name list in parentheses
+func (p *ddlParser) names() ([]string, error) {
+  toks, err := p.group()
+  if err != nil {
+    return nil, err
+  }
+
+  var names []string
+  for _, part := range splitCommas(toks) {
+    sub := &ddlParser{schema: p.schema, toks: part}
+    name, err := sub.ident()
+    if err != nil {
+      return nil, err
+    }
+    names = append(names, name)
+  }
+  return names, nil
+}
+
+// parse a referential action, e.g. SET NULL
+func (p *ddlParser) action() string {
+  switch {
+  case p.accept("cascade"):
+    return "CASCADE"
+  case p.accept("restrict"):
+    return "RESTRICT"
+  case p.accept("set", "null"):
+    return "SET NULL"
+  case p.accept("set", "default"):
+    return "SET DEFAULT"
+  case p.accept("no", "action"):
+    return "NO ACTION"
+  }
+  p.next()
+  return "NO ACTION"
+}
+
+// parse what follows REFERENCES
+func (p *ddlParser) references(fk *ddlForeignKey) error {
+  var err error
+  fk.refSchema, fk.refTable, err = p.qualifiedName()
+  if err != nil {
+    return err
+  }
+  if p.isPunct("(") {
+    fk.refColumns, err = p.names()
+    if err != nil {
+      return err
+    }
+  }
+
+  fk.onUpdate, fk.onDelete = "NO ACTION", "NO ACTION"
+  for {
+    switch {
+    case p.accept("on", "update"):
+      fk.onUpdate = p.action()
+    case p.accept("on", "delete"):
+      fk.onDelete = p.action()
+    case p.accept("match"):
+      p.next()
+    case p.accept("not", "deferrable"), p.accept("deferrable"),
+      p.accept("initially", "deferred"), p.accept("initially", "immediate"),
+      p.accept("not", "valid"):
+    default:
+      return nil
+    }
+  }
+}
+
+// the words ending a column type
+var ddlColumnStops = map[string]bool{
+  "not": true, "null": true, "default": true, "primary": true, "unique": true,
+  "auto_increment": true, "autoincrement": true, "comment": true, "references": true,
+  "generated": true, "check": true, "collate": true, "charset": true, "constraint": true,
+  "on": true, "as": true, "visible": true, "invisible": true, "key": true,
+  "unsigned": true, "signed": true, "zerofill": true, "srid": true, "storage": true,
+  "column_format": true, "with": true, "without": true, "array": true,
+}
+
+// parse a column type
+func (p *ddlParser) columnType() (ddlType, error) {
+  var typ ddlType
+
+  p.accept("national")
+  t := p.next()
+  if t.kind != tokWord && t.kind != tokIdent {
+    return typ, fmt.Errorf("expected a type, found %q", t.text)
+  }
+  words := []string{strings.ToLower(t.text)}
+  if p.isPunct(".") {
+    // a schema qualified user defined type
+    p.pos++
+    words = []string{strings.ToLower(p.next().text)}
+  }
+
+  // the types of more than one word
+  for {
+    next := p.peek()
+    if next.kind != tokWord || ddlColumnStops[strings.ToLower(next.text)] {
+      break
+    }
+    word := strings.ToLower(next.text)
+    if word == "character" && p.pos+1 < len(p.toks) && p.toks[p.pos+1].is("set") {
+      break
+    }
+    switch word {
+    case "precision", "varying", "varchar", "character", "char", "double", "integer", "int", "text", "blob":
+      words = append(words, word)
+      p.pos++
+      continue
+    }
+    break
+  }
+  typ.name = strings.Join(words, " ")
+
+  if p.isPunct("(") {
+    toks, err := p.group()
+    if err != nil {
+      return typ, err
+    }
+    for _, part := range splitCommas(toks) {
+      typ.params = append(typ.params, tokensText(part))
+    }
+  }
+
+  for {
+    switch {
+    case p.accept("with", "time", "zone"):
+      typ.timeZone = "with"
+    case p.accept("without", "time", "zone"):
+      typ.timeZone = "without"
+    case p.accept("unsigned"):
+      typ.unsigned = true
+    case p.accept("signed"):
+    case p.accept("zerofill"):
+      typ.zerofill = true
+      typ.unsigned = true
+    case p.isPunct("["):
+      p.pos++
+      for !p.done() && !p.isPunct("]") {
+        p.pos++
+      }
+      p.pos++
+      typ.array++
+    case p.accept("array"):
+      typ.array++
+    default:
+      return typ, nil
+    }
+  }
+}
+
+// parse an expression up to the next column constraint, comma or end
+func (p *ddlParser) expr() []ddlToken {
+  start := p.pos
+  depth := 0
+  for !p.done() {
+    t := p.peek()
+    if depth == 0 && p.pos > start {
+      if t.kind == tokPunct && (t.text == "," || t.text == ")") {
+        break
+      }
+      if t.kind == tokWord && ddlColumnStops[strings.ToLower(t.text)] && !t.is("null") {
+        break
+      }
+      if t.is("null") && p.pos > start && p.toks[p.pos-1].is("not") {
+        break
+      }
+    }
+    if t.kind == tokPunct {
+      switch t.text {
+      case "(":
+        depth++
+      case ")":
+        if depth == 0 {
+          return p.toks[start:p.pos]
+        }
+        depth--
+      }
+    }
+    p.pos++
+  }
+
+  toks := p.toks[start:p.pos]
+  // NOT of a following NOT NULL
+  if n := len(toks); n > 1 && toks[n-1].is("not") {
+    p.pos--
+    toks = toks[:n-1]
+  }
+  return toks
+}
+
+// parse a column definition into t
+func (p *ddlParser) column(t *ddlTable, col *ddlColumn) error {
+  var err error
+  col.name, err = p.ident()
+  if err != nil {
+    return err
+  }
+  col.typ, err = p.columnType()
+  if err != nil {
+    return err
+  }
+
+  // serial types are shorthands for auto incremented integers
+  switch p.schema.dialect + " " + col.typ.name {
+  case "mysql serial":
+    col.typ = ddlType{name: "bigint", unsigned: true}
+    col.notNull, col.autoinc = true, true
+    p.schema.addIndex(t, ddlIndex{columns: []string{col.name}, unique: true}, "key")
+  case "postgresql serial", "postgresql serial4", "postgresql bigserial", "postgresql serial8",
+    "postgresql smallserial", "postgresql serial2":
+    col.sequence = t.name + "_" + col.name + "_seq"
+    if t.schema != "public" {
+      col.sequence = t.schema + "." + col.sequence
+    }
+    col.notNull, col.autoinc = true, true
+  }
+
+  constraint := ""
+  for !p.done() && !p.isPunct(",") && !p.isPunct(")") {
+    switch {
+    case p.accept("constraint"):
+      constraint, err = p.ident()
+      if err != nil {
+        return err
+      }
+      continue
+    case p.accept("not", "null"):
+      col.notNull = true
+    case p.accept("null"):
+    case p.accept("default"):
+      col.def = p.expr()
+    case p.accept("primary", "key"):
+      p.schema.setPrimaryKey(t, []string{col.name}, constraint)
+      p.accept("asc")
+      p.accept("desc")
+    case p.accept("unique"):
+      p.accept("key")
+      p.schema.addIndex(t, ddlIndex{name: constraint, columns: []string{col.name}, unique: true}, "key")
+    case p.accept("key"):
+      // mysql: a primary key
+      p.schema.setPrimaryKey(t, []string{col.name}, "")
+    case p.accept("auto_increment"), p.accept("autoincrement"):
+      col.autoinc = true
+    case p.accept("comment"):
+      col.comment = p.next().text
+    case p.accept("references"):
+      fk := ddlForeignKey{name: constraint, columns: []string{col.name}}
+      err = p.references(&fk)
+      if err != nil {
+        return err
+      }
+      p.schema.addForeignKey(t, fk)
+    case p.accept("generated", "always", "as", "identity"), p.accept("generated", "by", "default", "as", "identity"):
+      col.autoinc, col.identity = true, true
+      if p.isPunct("(") {
+        p.group()
+      }
+    case p.accept("generated", "always", "as"), p.accept("as"):
+      toks, err := p.group()
+      if err != nil {
+        return err
+      }
+      if p.schema.dialect == "postgresql" {
+        col.def = toks
+      }
+      p.accept("stored")
+      p.accept("virtual")
+    case p.accept("check"):
+      p.group()
+    case p.accept("collate"), p.accept("character", "set"), p.accept("charset"),
+      p.accept("srid"), p.accept("storage"), p.accept("column_format"):
+      p.next()
+    case p.accept("on", "update"):
+      p.expr()
+    default:
+      // VISIBLE, INVISIBLE and the like
+      p.next()
+    }
+    constraint = ""
+  }
+
+  return nil
+}
+
+// parse a table constraint or index definition into t. It reports
+// false if the item is not one.
+func (p *ddlParser) constraint(t *ddlTable) (bool, error) {
+  start := p.pos
+
+  name := ""
+  if p.accept("constraint") {
+    // mysql allows CONSTRAINT without a name
+    if !p.is("primary") && !p.is("unique") && !p.is("foreign") && !p.is("check") {
+      var err error
+      name, err = p.ident()
+      if err != nil {
+        return false, err
+      }
+    }
+  }
+
+  // mysql index names, e.g. UNIQUE KEY name (...)
+  indexName := func() (string, error) {
+    if p.isPunct("(") || p.is("using") {
+      return name, nil
+    }
+    return p.ident()
+  }
+
+  var err error
+  switch {
+  case p.accept("primary", "key"):
+    p.accept("using", "btree")
+    var cols []string
+    cols, err = p.indexColumns()
+    p.schema.setPrimaryKey(t, cols, name)
+  case p.accept("unique"):
+    if !p.accept("key") {
+      p.accept("index")
+    }
+    idx := ddlIndex{unique: true}
+    idx.name, err = indexName()
+    if err == nil {
+      p.accept("using", "btree")
+      p.accept("using", "hash")
+      idx.columns, err = p.indexColumns()
+      p.schema.addIndex(t, idx, "key")
+    }
+  case p.accept("foreign", "key"):
+    fk := ddlForeignKey{name: name}
+    if !p.isPunct("(") {
+      // mysql: FOREIGN KEY index_name (...)
+      fk.index, err = p.ident()
+    }
+    if err == nil {
+      fk.columns, err = p.names()
+    }
+    if err == nil && p.accept("references") {
+      err = p.references(&fk)
+    }
+    p.schema.addForeignKey(t, fk)
+  case p.accept("key"), p.accept("index"):
+    idx := ddlIndex{}
+    idx.name, err = indexName()
+    if err == nil {
+      p.accept("using", "btree")
+      p.accept("using", "hash")
+      idx.columns, err = p.indexColumns()
+      p.schema.addIndex(t, idx, "idx")
+    }
+  case p.accept("fulltext"), p.accept("spatial"):
+    if !p.accept("key") {
+      p.accept("index")
+    }
+    idx := ddlIndex{}
+    idx.name, err = indexName()
+    if err == nil {
+      idx.columns, err = p.indexColumns()
+      p.schema.addIndex(t, idx, "idx")
+    }
+  case p.accept("check"), p.accept("exclude"), p.accept("like"):
+    p.skipItem()
+  default:
+    p.pos = start
+    return false, nil
+  }
+
+  if err != nil {
+    return false, err
+  }
+  // index options, NOT VALID, DEFERRABLE, ...
+  p.skipItem()
+  return true, nil
+}
+
+// parse a statement and apply it
+func (p *ddlParser) statement() error {
+  switch {
+  case p.accept("create"):
+    p.accept("or", "replace")
+    p.accept("temporary")
+    p.accept("temp")
+    p.accept("unlogged")
+    switch {
+    case p.accept("table"):
+      return p.createTable()
+    case p.is("unique"), p.is("index"):
+      return p.createIndex()
+    }
+  case p.accept("alter", "table"):
+    return p.alterTable()
+  case p.accept("drop", "table"):
+    return p.dropTable()
+  case p.accept("drop", "index"):
+    return p.dropIndex()
+  case p.accept("rename", "table"):
+    return p.renameTable()
+  case p.accept("comment", "on"):
+    return p.commentOn()
+  }
+  return nil
+}
+
+func (p *ddlParser) createTable() error {
+  ifNotExists := p.accept("if", "not", "exists")
+  schema, name, err := p.qualifiedName()
+  if err != nil {
+    return err
+  }
+  if p.schema.table(schema, name) != nil {
+    if ifNotExists {
+      return nil
+    }
+    return fmt.Errorf("table %s already exists", name)
+  }
+  if !p.isPunct("(") {
+    // CREATE TABLE ... AS SELECT or LIKE
+    return fmt.Errorf("only CREATE TABLE with column definitions is supported")
+  }
+
+  t := &ddlTable{schema: schema, name: name}
+  toks, err := p.group()
+  if err != nil {
+    return err
+  }
+  for _, item := range splitCommas(toks) {
+    sub := &ddlParser{schema: p.schema, toks: item}
+    ok, err := sub.constraint(t)
+    if err != nil {
+      return err
+    }
+    if ok {
+      continue
+    }
+    col := &ddlColumn{}
+    err = sub.column(t, col)
+    if err != nil {
+      return err
+    }
+    t.columns = append(t.columns, col)
+  }
+
+  // mysql table options
+  for !p.done() {
+    if p.accept("comment") {
+      if p.isPunct("=") {
+        p.pos++
+      }
+      t.comment = p.next().text
+      continue
+    }
+    p.next()
+  }
+
+  p.schema.tables = append(p.schema.tables, t)
+  return nil
+}
+
+func (p *ddlParser) createIndex() error {
+  unique := p.accept("unique")
+  p.accept("index")
+  p.accept("concurrently")
+  p.accept("if", "not", "exists")
+
+  name := ""
+  if !p.is("on") {
+    var err error
+    name, err = p.ident()
+    if err != nil {
+      return err
+    }
+  }
+  if !p.accept("on") {
+    return fmt.Errorf("expected ON")
+  }
+  p.accept("only")
+  schema, table, err := p.qualifiedName()
+  if err != nil {
+    return err
+  }
+  if p.accept("using") {
+    p.next()
+  }
+  cols, err := p.indexColumns()
+  if err != nil {
+    return err
+  }
+
+  t := p.schema.table(schema, table)
+  if t == nil {
+    return fmt.Errorf("no table %s", table)
+  }
+  p.schema.addIndex(t, ddlIndex{name: name, columns: cols, unique: unique}, "idx")
+  return nil
+}
+
+func (p *ddlParser) dropTable() error {
+  p.accept("if", "exists")
+  for {
+    schema, name, err := p.qualifiedName()
+    if err != nil {
+      return err
+    }
+    for i, t := range p.schema.tables {
+      if t.schema == schema && t.name == name {
+        p.schema.tables = append(p.schema.tables[:i], p.schema.tables[i+1:]...)
+        break
+      }
+    }
+    if !p.isPunct(",") {
+      return nil
+    }
+    p.pos++
+  }
+}
+
+func (p *ddlParser) dropIndex() error {
+  p.accept("concurrently")
+  p.accept("if", "exists")
+  schema, name, err := p.qualifiedName()
+  if err != nil {
+    return err
+  }
+
+  // mysql: DROP INDEX name ON table
+  if p.accept("on") {
+    tschema, table, err := p.qualifiedName()
+    if err != nil {
+      return err
+    }
+    if t := p.schema.table(tschema, table); t != nil {
+      t.dropIndex(name)
+    }
+    return nil
+  }
+
+  for _, t := range p.schema.tables {
+    if t.schema == schema {
+      t.dropIndex(name)
+    }
+  }
+  return nil
+}
+
+// drop the index or constraint named name
+func (t *ddlTable) dropIndex(name string) {
+  var indexes []ddlIndex
+  for _, idx := range t.indexes {
+    if idx.name != name {
+      indexes = append(indexes, idx)
+    }
+  }
+  t.indexes = indexes
+
+  var fks []ddlForeignKey
+  for _, fk := range t.fks {
+    if fk.name != name {
+      fks = append(fks, fk)
+    }
+  }
+  t.fks = fks
+
+  if t.pkName == name && name != "" {
+    t.pk, t.pkName = nil, ""
+  }
+}
+
+func (p *ddlParser) renameTable() error {
+  for {
+    schema, name, err := p.qualifiedName()
+    if err != nil {
+      return err
+    }
+    if !p.accept("to") {
+      return fmt.Errorf("expected TO")
+    }
+    toSchema, to, err := p.qualifiedName()
+    if err != nil {
+      return err
+    }
+    p.schema.renameTable(schema, name, toSchema, to)
+
+    if !p.isPunct(",") {
+      return nil
+    }
+    p.pos++
+  }
+}
+
+// rename a table, and the foreign keys referencing it
+func (s *ddlSchema) renameTable(schema, name, toSchema, to string) {
+  t := s.table(schema, name)
+  if t == nil {
+    return
+  }
+  t.schema, t.name = toSchema, to
+  for _, other := range s.tables {
+    for i, fk := range other.fks {
+      if fk.refSchema == schema && fk.refTable == name {
+        other.fks[i].refSchema, other.fks[i].refTable = toSchema, to
+      }
+    }
+  }
+}
+
+func (p *ddlParser) commentOn() error {
+  switch {
+  case p.accept("table"):
+    schema, name, err := p.qualifiedName()
+    if err != nil {
+      return err
+    }
+    if !p.accept("is") {
+      return fmt.Errorf("expected IS")
+    }
+    if t := p.schema.table(schema, name); t != nil {
+      t.comment = p.next().text
+    }
+  case p.accept("column"):
+    // [schema.]table.column
+    var parts []string
+    for {
+      part, err := p.ident()
+      if err != nil {
+        return err
+      }
+      parts = append(parts, part)
+      if !p.isPunct(".") {
+        break
+      }
+      p.pos++
+    }
+    if len(parts) < 2 || !p.accept("is") {
+      return fmt.Errorf("expected [schema.]table.column IS")
+    }
+    schema := p.schema.defaultSchema()
+    if len(parts) > 2 {
+      schema = parts[len(parts)-3]
+    }
+    if t := p.schema.table(schema, parts[len(parts)-2]); t != nil {
+      if col := t.column(parts[len(parts)-1]); col != nil {
+        col.comment = p.next().text
+      }
+    }
+  }
+  return nil
+}
+
+func (p *ddlParser) alterTable() error {
+  p.accept("if", "exists")
+  p.accept("only")
+  schema, name, err := p.qualifiedName()
+  if err != nil {
+    return err
+  }
+  t := p.schema.table(schema, name)
+  if t == nil {
+    return fmt.Errorf("no table %s", name)
+  }
+
+  for !p.done() {
+    err = p.alterAction(t)
+    if err != nil {
+      return err
+    }
+    p.skipItem()
+    if p.isPunct(",") {
+      p.pos++
+    }
+  }
+  return nil
+}
+
+// parse an ALTER TABLE action and apply it to t
+func (p *ddlParser) alterAction(t *ddlTable) error {
+  switch {
+  case p.accept("add"):
+    if ok, err := p.constraint(t); ok || err != nil {
+      return err
+    }
+    p.accept("column")
+    p.accept("if", "not", "exists")
+    col := &ddlColumn{}
+    err := p.column(t, col)
+    if err != nil {
+      return err
+    }
+    if t.column(col.name) == nil {
+      t.columns = append(t.columns, col)
+    }
+
+  case p.accept("drop"):
+    switch {
+    case p.accept("primary", "key"):
+      t.pk, t.pkName = nil, ""
+    case p.accept("constraint"), p.accept("index"), p.accept("key"), p.accept("foreign", "key"):
+      p.accept("if", "exists")
+      name, err := p.ident()
+      if err != nil {
+        return err
+      }
+      t.dropIndex(name)
+    default:
+      p.accept("column")
+      p.accept("if", "exists")
+      name, err := p.ident()
+      if err != nil {
+        return err
+      }
+      t.dropColumn(name)
+    }
+
+  case p.accept("rename"):
+    switch {
+    case p.accept("to"), p.accept("as"):
+      schema, to, err := p.qualifiedName()
+      if err != nil {
+        return err
+      }
+      p.schema.renameTable(t.schema, t.name, schema, to)
+    case p.accept("constraint"), p.accept("index"), p.accept("key"):
+      from, err := p.ident()
+      if err != nil {
+        return err
+      }
+      p.accept("to")
+      to, err := p.ident()
+      if err != nil {
+        return err
+      }
+      for i := range t.indexes {
+        if t.indexes[i].name == from {
+          t.indexes[i].name = to
+        }
+      }
+      for i := range t.fks {
+        if t.fks[i].name == from {
+          t.fks[i].name = to
+        }
+      }
+    default:
+      p.accept("column")
+      from, err := p.ident()
+      if err != nil {
+        return err
+      }
+      p.accept("to")
+      to, err := p.ident()
+      if err != nil {
+        return err
+      }
+      p.schema.renameColumn(t, from, to)
+    }
+
+  case p.accept("alter"):
+    p.accept("column")
+    name, err := p.ident()
+    if err != nil {
+      return err
+    }
+    col := t.column(name)
+    if col == nil {
+      return fmt.Errorf("no column %s", name)
+    }
+    switch {
+    case p.accept("set", "not", "null"):
+      col.notNull = true
+    case p.accept("drop", "not", "null"):
+      col.notNull = false
+    case p.accept("set", "default"):
+      col.def = p.expr()
+      col.dropSequence()
+    case p.accept("drop", "default"):
+      col.def = nil
+      col.dropSequence()
+    case p.accept("set", "data", "type"), p.accept("type"):
+      col.typ, err = p.columnType()
+      return err
+    case p.accept("add", "generated"):
+      col.autoinc, col.identity = true, true
+    case p.accept("drop", "identity"):
+      col.autoinc, col.identity = false, false
+    }
+
+  case p.accept("modify"):
+    // mysql: MODIFY [COLUMN] definition
+    p.accept("column")
+    col := &ddlColumn{}
+    err := p.column(t, col)
+    if err != nil {
+      return err
+    }
+    t.replaceColumn(col.name, col)
+
+  case p.accept("change"):
+    // mysql: CHANGE [COLUMN] old definition
+    p.accept("column")
+    from, err := p.ident()
+    if err != nil {
+      return err
+    }
+    col := &ddlColumn{}
+    err = p.column(t, col)
+    if err != nil {
+      return err
+    }
+    p.schema.renameColumn(t, from, col.name)
+    t.replaceColumn(col.name, col)
+  }
+
+  return nil
+}
+
+// replace the definition of the column named name
+func (t *ddlTable) replaceColumn(name string, col *ddlColumn) {
+  for i, c := range t.columns {
+    if c.name == name {
+      t.columns[i] = col
+    }
+  }
+}
+
+// drop a column, and the keys, indexes and foreign keys using it
+func (t *ddlTable) dropColumn(name string) {
+  var cols []*ddlColumn
+  for _, col := range t.columns {
+    if col.name != name {
+      cols = append(cols, col)
+    }
+  }
+  t.columns = cols
+
+  for _, col := range t.pk {
+    if col == name {
+      t.pk, t.pkName = nil, ""
+      break
+    }
+  }
+
+  var indexes []ddlIndex
+  for _, idx := range t.indexes {
+    if !contains(idx.columns, name) {
+      indexes = append(indexes, idx)
+    }
+  }
+  t.indexes = indexes
+
+  var fks []ddlForeignKey
+  for _, fk := range t.fks {
+    if !contains(fk.columns, name) {
+      fks = append(fks, fk)
+    }
+  }
+  t.fks = fks
+}
+
+// rename a column of t everywhere it is used
+func (s *ddlSchema) renameColumn(t *ddlTable, from, to string) {
+  if col := t.column(from); col != nil {
+    col.name = to
+  }
+  rename := func(names []string) {
+    for i, name := range names {
+      if name == from {
+        names[i] = to
+      }
+    }
+  }
+
+  rename(t.pk)
+  for _, idx := range t.indexes {
+    rename(idx.columns)
+  }
+  for _, fk := range t.fks {
+    rename(fk.columns)
+  }
+  for _, other := range s.tables {
+    for _, fk := range other.fks {
+      if fk.refSchema == t.schema && fk.refTable == t.name {
+        rename(fk.refColumns)
+      }
+    }
+  }
+}
+
+// report whether list contains s
+func contains(list []string, s string) bool {
+  for _, v := range list {
+    if v == s {
+      return true
+    }
+  }
+  return false
+}
+
+// report whether an index or constraint of t's schema is named name.
+// mysql index names are per table, postgresql ones per schema.
+func (s *ddlSchema) nameUsed(t *ddlTable, name string) bool {
+  tables := []*ddlTable{t}
+  if s.dialect == "postgresql" {
+    for _, other := range s.tables {
+      if other != t && other.schema == t.schema {
+        tables = append(tables, other)
+      }
+    }
+  }
+
+  for _, t := range tables {
+    if strings.EqualFold(t.pkName, name) {
+      return true
+    }
+    for _, idx := range t.indexes {
+      if strings.EqualFold(idx.name, name) {
+        return true
+      }
+    }
+    for _, fk := range t.fks {
+      if strings.EqualFold(fk.name, name) {
+        return true
+      }
+    }
+  }
+  return false
+}
+
+// return the name postgresql gives a constraint or index of t: the
+// table and column names and a label such as "key", numbered if taken
+func (s *ddlSchema) postgresqlName(t *ddlTable, columns []string, label string) string {
+  parts := []string{t.name}
+  for _, col := range columns {
+    if col == "" {
+      col = "expr"
+    }
+    parts = append(parts, col)
+  }
+  base := strings.Join(parts, "_") + "_" + label
+
+  name := base
+  for n := 1; s.nameUsed(t, name); n++ {
+    name = fmt.Sprintf("%s%d", base, n)
+  }
+  return name
+}
+
+// return the name mysql gives an index: its first column, numbered
+// if taken
+func (s *ddlSchema) mysqlIndexName(t *ddlTable, columns []string) string {
+  base := "functional_index"
+  if len(columns) > 0 && columns[0] != "" {
+    base = columns[0]
+  }
+
+  name := base
+  for n := 2; s.nameUsed(t, name); n++ {
+    name = fmt.Sprintf("%s_%d", base, n)
+  }
+  return name
+}
+
+// set the primary key of t
+func (s *ddlSchema) setPrimaryKey(t *ddlTable, columns []string, name string) {
+  switch {
+  case s.dialect == "mysql":
+    name = "PRIMARY"
+  case name == "":
+    name = s.postgresqlName(t, nil, "pkey")
+  }
+  t.pk, t.pkName = columns, name
+}
+
+// add an index to t, naming it if needed. label is the postgresql
+// name suffix: "key" for unique constraints and "idx" for indexes.
+func (s *ddlSchema) addIndex(t *ddlTable, idx ddlIndex, label string) {
+  if idx.name == "" {
+    if s.dialect == "mysql" {
+      idx.name = s.mysqlIndexName(t, idx.columns)
+    } else {
+      idx.name = s.postgresqlName(t, idx.columns, label)
+    }
+  }
+  t.indexes = append(t.indexes, idx)
+}
+
+// add a foreign key to t, naming it if needed
+func (s *ddlSchema) addForeignKey(t *ddlTable, fk ddlForeignKey) {
+  if fk.name != "" && s.dialect == "mysql" {
+    // the index created for it is named after the constraint
+    fk.index = fk.name
+  }
+
+  if fk.name == "" && s.dialect == "mysql" {
+    // one more than the highest numbered of the table
+    n := 0
+    for _, other := range t.fks {
+      var i int
+      if _, err := fmt.Sscanf(other.name, t.name+"_ibfk_%d", &i); err == nil && i > n {
+        n = i
+      }
+    }
+    fk.name = fmt.Sprintf("%s_ibfk_%d", t.name, n+1)
+  } else if fk.name == "" {
+    fk.name = s.postgresqlName(t, fk.columns, "fkey")
+  }
+  t.fks = append(t.fks, fk)
+}
+
+// return the tables in the schemas read, sorted like the introspection
+// queries sort them
+func (s *ddlSchema) selected() []*ddlTable {
+  var tables []*ddlTable
+  for _, t := range s.tables {
+    switch {
+    case len(schemas) > 0:
+      if !contains(schemas, t.schema) {
+        continue
+      }
+    case s.dialect == "postgresql" && t.schema != "public":
+      continue
+    }
+    tables = append(tables, t)
+  }
+
+  sort.SliceStable(tables, func(i, j int) bool {
+    if tables[i].schema != tables[j].schema {
+      return tables[i].schema < tables[j].schema
+    }
+    return tables[i].name < tables[j].name
+  })
+  return tables
+}
+
+// return the referenced columns of a foreign key: those declared, or
+// the primary key of the referenced table
+func (s *ddlSchema) refColumns(fk ddlForeignKey) []string {
+  if len(fk.refColumns) > 0 {
+    return fk.refColumns
+  }
+  if t := s.table(fk.refSchema, fk.refTable); t != nil {
+    return t.pk
+  }
+  return nil
+}
+
+// return whether the index columns start with columns
+func hasPrefix(index, columns []string) bool {
+  if len(index) < len(columns) {
+    return false
+  }
+  for i, col := range columns {
+    if index[i] != col {
+      return false
+    }
+  }
+  return true
+}
+
+// the indexes of a mysql table, with those created for foreign keys
+// without one
+func (s *ddlSchema) mysqlIndexes(t *ddlTable) []ddlIndex {
+  indexes := t.indexes
+  if len(t.pk) > 0 {
+    indexes = append([]ddlIndex{{name: "PRIMARY", columns: t.pk, unique: true, primary: true}}, indexes...)
+  }
+
+  for _, fk := range t.fks {
+    found := false
+    for _, idx := range indexes {
+      if hasPrefix(idx.columns, fk.columns) {
+        found = true
+        break
+      }
+    }
+    if found {
+      continue
+    }
+
+    name := fk.index
+    if name == "" {
+      name = s.mysqlIndexName(&ddlTable{indexes: indexes}, fk.columns)
+    }
+    indexes = append(indexes, ddlIndex{name: name, columns: fk.columns})
+  }
+
+  // index_name sorts case insensitively
+  sort.SliceStable(indexes, func(i, j int) bool {
+    return strings.ToLower(indexes[i].name) < strings.ToLower(indexes[j].name)
+  })
+  return indexes
+}
+
+// the mysql column_type of a declared type, e.g. "int(11)" is "int"
+// and "numeric" is "decimal(10,0)"
+func mysqlColumnType(typ ddlType) string {
+  name, params := typ.name, typ.params
+  switch name {
+  case "integer", "int4":
+    name = "int"
+  case "int1":
+    name = "tinyint"
+  case "int2":
+    name = "smallint"
+  case "int3", "middleint":
+    name = "mediumint"
+  case "int8":
+    name = "bigint"
+  case "bool", "boolean":
+    name, params = "tinyint", []string{"1"}
+  case "dec", "numeric", "fixed":
+    name = "decimal"
+  case "real", "double precision", "float8":
+    name = "double"
+  case "float4":
+    name = "float"
+  case "character":
+    name = "char"
+  case "character varying", "char varying", "varcharacter":
+    name = "varchar"
+  case "long varchar", "long":
+    name = "mediumtext"
+  case "long varbinary":
+    name = "mediumblob"
+  }
+
+  switch name {
+  case "tinyint", "smallint", "mediumint", "int", "bigint":
+    // display widths are dropped, but for tinyint(1) and zerofill
+    if !typ.zerofill && !(name == "tinyint" && len(params) == 1 && params[0] == "1") {
+      params = nil
+    }
+  case "decimal":
+    switch len(params) {
+    case 0:
+      params = []string{"10", "0"}
+    case 1:
+      params = append(params, "0")
+    }
+  case "float":
+    if len(params) == 1 {
+      var p int
+      fmt.Sscanf(params[0], "%d", &p)
+      if p > 24 {
+        name = "double"
+      }
+      params = nil
+    }
+  case "char", "binary", "bit":
+    if len(params) == 0 {
+      params = []string{"1"}
+    }
+  case "year":
+    params = nil
+  }
+
+  s := name
+  if len(params) > 0 {
+    s += "(" + strings.Join(params, ",") + ")"
+  }
+  if typ.unsigned {
+    s += " unsigned"
+  }
+  if typ.zerofill {
+    s += " zerofill"
+  }
+  return s
+}
+
+// the mysql character_maximum_length of a column type
+func mysqlLength(ctype string) int64 {
+  typ, _ := parseMysqlType(ctype)
+  switch typ {
+  case "char", "varchar", "binary", "varbinary":
+    var n int64
+    fmt.Sscanf(ctype[len(typ):], "(%d)", &n)
+    return n
+  case "tinytext", "tinyblob":
+    return 255
+  case "text", "blob":
+    return 65535
+  case "mediumtext", "mediumblob":
+    return 16777215
+  case "longtext", "longblob":
+    return 4294967295
+  case "enum":
+    var n int64
+    for _, v := range parseMysqlValues(ctype) {
+      if l := int64(len([]rune(v))); l > n {
+        n = l
+      }
+    }
+    return n
+  case "set":
+    values := parseMysqlValues(ctype)
+    n := int64(len(values) - 1)
+    for _, v := range values {
+      n += int64(len([]rune(v)))
+    }
+    return n
+  }
+  return 0
+}
+
+// the mysql column_default of a default expression
+func mysqlDefault(toks []ddlToken, ctype string) *string {
+  if len(toks) == 0 || len(toks) == 1 && toks[0].is("null") {
+    return nil
+  }
+
+  def := tokensText(toks)
+  switch first := toks[0]; {
+  case len(toks) == 1 && first.kind == tokString:
+    def = first.text
+  case len(toks) == 1 && first.is("true"):
+    def = "1"
+  case len(toks) == 1 && first.is("false"):
+    def = "0"
+  case len(toks) == 1 && first.kind == tokNumber:
+    // decimals are stored with their scale
+    var scale int
+    if typ, _ := parseMysqlType(ctype); typ == "decimal" {
+      fmt.Sscanf(ctype[strings.Index(ctype, ",")+1:], "%d", &scale)
+      var f float64
+      fmt.Sscanf(first.text, "%g", &f)
+      def = fmt.Sprintf("%.*f", scale, f)
+    }
+  case first.is("current_timestamp"), first.is("now"), first.is("localtime"), first.is("localtimestamp"):
+    def = "CURRENT_TIMESTAMP"
+    if len(toks) == 4 && toks[2].kind == tokNumber {
+      def += "(" + toks[2].text + ")"
+    }
+  case first.kind == tokPunct && first.text == "(" && toks[len(toks)-1].text == ")":
+    def = tokensText(toks[1 : len(toks)-1])
+  }
+  return &def
+}
+
+// add the tables to md as mysql introspection would
+func (s *ddlSchema) mysql(md *Metadata) {
+  for _, t := range s.selected() {
+    strct := Struct{
+      Name:      t.name,
+      Schema:    tableSchema(t.schema),
+      CleanName: tableStructName(t.schema, t.name),
+      Comment:   t.comment,
+    }
+
+    for _, col := range t.columns {
+      ctype := mysqlColumnType(col.typ)
+      typ, sign := parseMysqlType(ctype)
+      f := Field{
+        Name:          col.name,
+        CleanName:     formatFieldName(col.name),
+        Type:          mysqlGoType(typ, sign),
+        Nullable:      !col.notNull && !contains(t.pk, col.name),
+        SQLType:       ctype,
+        Unsigned:      sign == "unsigned",
+        Default:       mysqlDefault(col.def, ctype),
+        Comment:       col.comment,
+        AutoIncrement: col.autoinc,
+        Length:        mysqlLength(ctype),
+      }
+      if typ == "enum" || typ == "set" {
+        f.Values = parseMysqlValues(ctype)
+      }
+      strct.Fields = append(strct.Fields, f)
+    }
+
+    for _, col := range t.pk {
+      strct.setPrimaryKey(col)
+    }
+    for _, idx := range s.mysqlIndexes(t) {
+      for _, col := range idx.columns {
+        strct.addIndexColumn(idx.name, idx.unique, idx.primary, col)
+      }
+    }
+
+    fks := append([]ddlForeignKey(nil), t.fks...)
+    sort.SliceStable(fks, func(i, j int) bool {
+      return strings.ToLower(fks[i].name) < strings.ToLower(fks[j].name)
+    })
+    for _, fk := range fks {
+      refColumns := s.refColumns(fk)
+      for i, col := range fk.columns {
+        if i < len(refColumns) {
+          strct.addForeignKeyColumn(fk.name, col, tableSchema(fk.refSchema), fk.refTable, refColumns[i], fk.onUpdate, fk.onDelete)
+        }
+      }
+    }
+
+    md.Structs = append(md.Structs, strct)
+  }
+}
+
+// the postgresql pg_type.typname and format_type of a declared type,
+// e.g. "int" is "int4" and "integer"
+func postgresqlType(typ ddlType) (typname, format string) {
+  name, params := typ.name, typ.params
+  suffix := ""
+  switch name {
+  case "smallint", "int2", "smallserial", "serial2":
+    typname, format = "int2", "smallint"
+  case "integer", "int", "int4", "serial", "serial4":
+    typname, format = "int4", "integer"
+  case "bigint", "int8", "bigserial", "serial8":
+    typname, format = "int8", "bigint"
+  case "real", "float4":
+    typname, format = "float4", "real"
+  case "double precision", "float8":
+    typname, format = "float8", "double precision"
+  case "float":
+    typname, format = "float8", "double precision"
+    if len(params) == 1 {
+      var p int
+      fmt.Sscanf(params[0], "%d", &p)
+      if p <= 24 {
+        typname, format = "float4", "real"
+      }
+    }
+    params = nil
+  case "numeric", "decimal":
+    typname, format = "numeric", "numeric"
+    if len(params) == 1 {
+      params = append(params, "0")
+    }
+  case "boolean", "bool":
+    typname, format = "bool", "boolean"
+  case "varchar", "character varying", "char varying":
+    typname, format = "varchar", "character varying"
+  case "char", "character", "bpchar":
+    typname, format = "bpchar", "character"
+    if len(params) == 0 && name != "bpchar" {
+      params = []string{"1"}
+    }
+  case "timestamp", "timestamptz":
+    typname, format, suffix = "timestamp", "timestamp", " without time zone"
+    if typ.timeZone == "with" || name == "timestamptz" {
+      typname, suffix = "timestamptz", " with time zone"
+    }
+  case "time", "timetz":
+    typname, format, suffix = "time", "time", " without time zone"
+    if typ.timeZone == "with" || name == "timetz" {
+      typname, suffix = "timetz", " with time zone"
+    }
+  case "bit":
+    typname, format = "bit", "bit"
+    if len(params) == 0 {
+      params = []string{"1"}
+    }
+  case "bit varying", "varbit":
+    typname, format = "varbit", "bit varying"
+  default:
+    typname, format = name, name
+  }
+
+  if len(params) > 0 {
+    format += "(" + strings.Join(params, ",") + ")"
+  }
+  format += suffix
+  if typ.array > 0 {
+    typname, format = "_"+typname, format+"[]"
+  }
+  return
+}
+
+// the SQL values functions postgresql keeps upper case in defaults
+var postgresqlValueFuncs = map[string]bool{
+  "current_timestamp": true, "current_date": true, "current_time": true,
+  "localtimestamp": true, "localtime": true, "current_user": true,
+  "session_user": true, "current_role": true,
+}
+
+// the postgresql pg_get_expr of a default expression: literals are
+// cast to the column type and functions lower case
+func postgresqlDefault(toks []ddlToken, typname, format string) *string {
+  if len(toks) == 0 || len(toks) == 1 && toks[0].is("null") {
+    return nil
+  }
+
+  // the type a literal is cast to, without its modifiers
+  cast := format
+  if i := strings.Index(cast, "("); i >= 0 {
+    cast = cast[:i] + cast[strings.Index(cast, ")")+1:]
+  }
+  if typname == "bpchar" {
+    cast = "bpchar"
+  }
+
+  var def string
+  switch first := toks[0]; {
+  case len(toks) == 1 && first.kind == tokString:
+    def = "'" + strings.Replace(first.text, "'", "''", -1) + "'::" + cast
+  case len(toks) == 2 && first.text == "-" && toks[1].kind == tokNumber:
+    def = "'-" + toks[1].text + "'::" + cast
+  case len(toks) == 1 && (first.is("true") || first.is("false")):
+    def = strings.ToLower(first.text)
+  case len(toks) == 1 && first.kind == tokWord && postgresqlValueFuncs[strings.ToLower(first.text)]:
+    def = strings.ToUpper(first.text)
+  default:
+    lower := make([]ddlToken, len(toks))
+    for i, t := range toks {
+      if t.kind == tokWord {
+        t.text = strings.ToLower(t.text)
+      }
+      lower[i] = t
+    }
+    def = tokensText(lower)
+  }
+  return &def
+}
+
+// add the tables to md as postgresql introspection would
+func (s *ddlSchema) postgresql(md *Metadata) {
+  for _, t := range s.selected() {
+    strct := Struct{
+      Name:      t.name,
+      Schema:    tableSchema(t.schema),
+      CleanName: tableStructName(t.schema, t.name),
+      Comment:   t.comment,
+    }
+
+    for _, col := range t.columns {
+      typname, format := postgresqlType(col.typ)
+      f := Field{
+        Name:          col.name,
+        CleanName:     formatFieldName(col.name),
+        Type:          postgresqlGoType(typname),
+        Nullable:      !col.notNull && !contains(t.pk, col.name),
+        SQLType:       format,
+        Default:       postgresqlDefault(col.def, typname, format),
+        Comment:       col.comment,
+        AutoIncrement: col.autoinc,
+      }
+      if col.sequence != "" {
+        def := "nextval('" + col.sequence + "'::regclass)"
+        f.Default = &def
+      }
+      if f.Default != nil && strings.HasPrefix(*f.Default, "nextval(") {
+        f.AutoIncrement = true
+      }
+      if (typname == "varchar" || typname == "bpchar") && len(col.typ.params) > 0 {
+        fmt.Sscanf(col.typ.params[0], "%d", &f.Length)
+      } else if typname == "bpchar" && col.typ.name != "bpchar" {
+        f.Length = 1
+      }
+      strct.Fields = append(strct.Fields, f)
+    }
+
+    indexes := t.indexes
+    if len(t.pk) > 0 {
+      indexes = append([]ddlIndex{{name: t.pkName, columns: t.pk, unique: true, primary: true}}, indexes...)
+    }
+    sort.SliceStable(indexes, func(i, j int) bool {
+      return indexes[i].name < indexes[j].name
+    })
+    for _, idx := range indexes {
+      for _, col := range idx.columns {
+        strct.addIndexColumn(idx.name, idx.unique, idx.primary, col)
+        if idx.primary {
+          strct.setPrimaryKey(col)
+        }
+      }
+    }
+
+    fks := append([]ddlForeignKey(nil), t.fks...)
+    sort.SliceStable(fks, func(i, j int) bool {
+      return fks[i].name < fks[j].name
+    })
+    for _, fk := range fks {
+      refColumns := s.refColumns(fk)
+      for i, col := range fk.columns {
+        if i < len(refColumns) {
+          strct.addForeignKeyColumn(fk.name, col, tableSchema(fk.refSchema), fk.refTable, refColumns[i], fk.onUpdate, fk.onDelete)
+        }
+      }
+    }
+
+    md.Structs = append(md.Structs, strct)
+  }
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+  "encoding/json"
+  "fmt"
+  "os"
+  "reflect"
+)
+
+// -dump-schema writes the model read from the database as JSON and
+// -from-schema generates the code from such a file, so reading the
+// schema and generating from it can happen apart.
+
+// the version of the -dump-schema format, raised when it changes in a
+// way older versions of kdb can not read
+const schemaVersion = 1
+
+// a -dump-schema file
+// Usage:
+//  {
+//    "version": 1,
+//    "dialect": "postgresql",
+//    "tables": [
+//      {
+//        "name": "users",
+//        "columns": [
+//          {"name": "id", "sql_type": "bigint", "primary_key": true, "auto_increment": true, "type": "int64"},
+//          {"name": "email", "nullable": true, "sql_type": "text", "type": "string"}
+//        ],
+//        "primary_key": ["id"],
+//        "indexes": [{"name": "users_pkey", "columns": ["id"], "unique": true, "primary": true}]
+//      }
+//    ]
+//  }
+type schemaFile struct {
+  Version int      `json:"version"`
+  Dialect string   `json:"dialect"`
+  Structs []Struct `json:"tables"`
+}
+
+// the Go types of fields by the names a dump writes them with
+var dumpTypes = map[string]reflect.Type{
+  "string":    reflect.TypeOf(""),
+  "int64":     reflect.TypeOf(int64(0)),
+  "uint64":    reflect.TypeOf(uint64(0)),
+  "float64":   reflect.TypeOf(float64(0)),
+  "bool":      reflect.TypeOf(true),
+  "[]byte":    reflect.TypeOf([]byte{}),
+  "time.Time": timeType,
+}
+
+// the field as JSON, with its type by name
+func (f Field) MarshalJSON() ([]byte, error) {
+  // without the methods, so it is marshaled as a plain struct
+  type field Field
+
+  name := ""
+  for n, typ := range dumpTypes {
+    if typ == f.Type {
+      name = n
+    }
+  }
+  if name == "" {
+    return nil, fmt.Errorf("column %s: can not dump the type %v", f.Name, f.Type)
+  }
+
+  return json.Marshal(struct {
+    field
+    Type string `json:"type"`
+  }{field(f), name})
+}
+
+func (f *Field) UnmarshalJSON(b []byte) error {
+  type field Field
+
+  v := struct {
+    *field
+    Type string `json:"type"`
+  }{field: (*field)(f)}
+  err := json.Unmarshal(b, &v)
+  if err != nil {
+    return err
+  }
+
+  typ, ok := dumpTypes[v.Type]
+  if !ok {
+    return fmt.Errorf("column %s: unknown type %q", f.Name, v.Type)
+  }
+  f.Type = typ
+  return nil
+}
+
+// write the structs of md to path, or stdout if it is "-"
+func dumpSchema(md *Metadata, path string) error {
+  b, err := json.MarshalIndent(schemaFile{
+    Version: schemaVersion,
+    Dialect: md.Dialect,
+    Structs: md.Structs,
+  }, "", "  ")
+  if err != nil {
+    return err
+  }
+  b = append(b, '\n')
+
+  if path == "-" {
+    _, err = os.Stdout.Write(b)
+    return err
+  }
+  return os.WriteFile(path, b, 0644)
+}
+
+// read the dialect and the structs of a -dump-schema file into md,
+// formatting their names with the naming flags
+func loadSchema(md *Metadata, path string) error {
+  b, err := os.ReadFile(path)
+  if err != nil {
+    return err
+  }
+
+  var file schemaFile
+  err = json.Unmarshal(b, &file)
+  if err != nil {
+    return fmt.Errorf("%s: %v", path, err)
+  }
+  switch {
+  case file.Version == 0:
+    return fmt.Errorf("%s: not a kdb schema dump", path)
+  case file.Version > schemaVersion:
+    return fmt.Errorf("%s: schema dump version %d is newer than this kdb reads (%d)", path, file.Version, schemaVersion)
+  }
+
+  // struct names are prefixed with the schema when the tables come
+  // from more than one, as with -schema
+  seen := make(map[string]bool)
+  for _, strct := range file.Structs {
+    seen[strct.Schema] = true
+  }
+
+  for i := range file.Structs {
+    strct := &file.Structs[i]
+    strct.CleanName = formatStructName(strct.Name)
+    if len(seen) > 1 {
+      strct.CleanName = formatStructName(strct.Schema + "_" + strct.Name)
+    }
+    for j := range strct.Fields {
+      strct.Fields[j].CleanName = formatFieldName(strct.Fields[j].Name)
+    }
+  }
+
+  md.Dialect = file.Dialect
+  md.Structs = append(md.Structs, file.Structs...)
+  return nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+  "fmt"
+  "path"
+  "regexp"
+  "strings"
+)
+
+// a flag holding a list of comma separated values, which may be given
+// more than once
+type listFlag []string
+
+func (l *listFlag) String() string {
+  return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+  for _, v := range strings.Split(value, ",") {
+    if v = strings.TrimSpace(v); v != "" {
+      *l = append(*l, v)
+    }
+  }
+  return nil
+}
+
+// a flag holding table name patterns: globs such as "order_*", or
+// regular expressions between slashes such as "/^(users|orders)$/".
+// It may be given more than once, and each value may hold several
+// comma separated globs. Regular expressions are compiled by Set, so
+// a bad one is a flag error.
+type patternsFlag struct {
+  list    []string
+  regexps map[string]*regexp.Regexp
+  set     bool
+}
+
+func (p *patternsFlag) String() string {
+  return strings.Join(p.list, ",")
+}
+
+func (p *patternsFlag) Set(value string) error {
+  p.set = true
+
+  values := []string{value}
+  if !isRegexp(value) {
+    values = strings.Split(value, ",")
+  }
+
+  for _, v := range values {
+    v = strings.TrimSpace(v)
+    if v == "" {
+      continue
+    }
+
+    var re *regexp.Regexp
+    var err error
+    if isRegexp(v) {
+      re, err = regexp.Compile(v[1 : len(v)-1])
+    } else {
+      _, err = path.Match(v, "")
+    }
+    if err != nil {
+      return fmt.Errorf("bad pattern %q: %v", v, err)
+    }
+
+    if re != nil {
+      if p.regexps == nil {
+        p.regexps = make(map[string]*regexp.Regexp)
+      }
+      p.regexps[v] = re
+    }
+    p.list = append(p.list, v)
+  }
+
+  return nil
+}
+
+// report whether any of the names matches any of the patterns
+func (p *patternsFlag) match(names ...string) bool {
+  for _, pattern := range p.list {
+    for _, name := range names {
+      if re, ok := p.regexps[pattern]; ok {
+        if re.MatchString(name) {
+          return true
+        }
+      } else if ok, _ := path.Match(pattern, name); ok {
+        return true
+      }
+    }
+  }
+  return false
+}
+
+// report whether a pattern is a regular expression
+func isRegexp(pattern string) bool {
+  return len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/")
+}
+
+// return the names a struct's table may be matched by: its name, and
+// with its schema if it has one
+func (s Struct) names() []string {
+  if s.Schema == "" {
+    return []string{s.Name}
+  }
+  return []string{s.Schema + "." + s.Name, s.Name}
+}
+
+// remove the structs not selected by -tables, -views, -matviews and
+// -exclude. Without -views, views are selected by -tables; materialized
+// views are only generated when selected by -matviews.
+func (md *Metadata) filter() {
+  var structs []Struct
+  for _, strct := range md.Structs {
+    names := strct.names()
+
+    selected := !tables.set || tables.match(names...)
+    switch {
+    case strct.Materialized:
+      selected = matviews.match(names...)
+    case strct.View && views.set:
+      selected = views.match(names...)
+    }
+
+    if selected && !exclude.match(names...) {
+      structs = append(structs, strct)
+    }
+  }
+  md.Structs = structs
+}
+
+// return the condition restricting column to the -schema values, or
+// to current when there are none, and its arguments
+func (md *Metadata) inSchemas(column, current string) (string, []interface{}) {
+  if len(schemas) == 0 {
+    return column + " = " + current, nil
+  }
+
+  var phs []string
+  var args []interface{}
+  for i, schema := range schemas {
+    phs = append(phs, md.placeholder(i+1))
+    args = append(args, schema)
+  }
+  return column + " IN (" + strings.Join(phs, ", ") + ")", args
+}
+
+// return the schema to record for a table: none unless -schema was
+// given, in which case the generated SQL qualifies table names
+func tableSchema(schema string) string {
+  if len(schemas) == 0 {
+    return ""
+  }
+  return schema
+}
+
+// return the struct name for a table, prefixed with its schema when
+// tables come from more than one
+func tableStructName(schema, table string) string {
+  if len(schemas) > 1 {
+    return formatStructName(schema + "_" + table)
+  }
+  return formatStructName(table)
+}
+
+// return the quoted, and if needed schema qualified, table of a struct
+func (md *Metadata) table(strct Struct) string {
+  if strct.Schema == "" {
+    return md.quote(strct.Name)
+  }
+  return md.quote(strct.Schema) + "." + md.quote(strct.Name)
+}
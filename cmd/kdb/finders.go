@@ -0,0 +1,104 @@
+package main
+
+import (
+  "fmt"
+  "sort"
+  "strings"
+)
+
+// a lookup a finder is generated for: the leading columns of an
+// index, and whether they are unique
+type finder struct {
+  columns []string
+  unique  bool
+}
+
+// return the lookups covered by the indexes of a struct. Every index
+// is covered by its leading columns; only the full column list of a
+// unique index finds a single row. With -crud, the primary key is left
+// to Get<name>ByPK.
+func finders(strct Struct) []finder {
+  lookups := make(map[string]*finder)
+  for _, idx := range strct.Indexes {
+    for n := 1; n <= len(idx.Columns); n++ {
+      // an expression ends what we can look up
+      if idx.Columns[n-1] == "" {
+        break
+      }
+
+      cols := idx.Columns[:n]
+      unique := idx.Unique && n == len(idx.Columns)
+      if unique && *crud && strings.Join(cols, "\x00") == strings.Join(strct.PrimaryKey, "\x00") {
+        continue
+      }
+
+      key := strings.Join(cols, "\x00")
+      if f, ok := lookups[key]; ok {
+        f.unique = f.unique || unique
+        continue
+      }
+      lookups[key] = &finder{columns: cols, unique: unique}
+    }
+  }
+
+  var keys []string
+  for key := range lookups {
+    keys = append(keys, key)
+  }
+  sort.Strings(keys)
+
+  var ret []finder
+  for _, key := range keys {
+    ret = append(ret, *lookups[key])
+  }
+  return ret
+}
+
+// return the fields of a lookup and the name of the function
+// generated for it, or false if one of its columns is missing
+func finderFunc(strct Struct, lookup finder) ([]Field, string, bool) {
+  fields, ok := fieldsNamed(strct, lookup.columns)
+  if !ok {
+    return nil, "", false
+  }
+
+  prefix := "List"
+  if lookup.unique {
+    prefix = "Find"
+  }
+  return fields, prefix + strct.CleanName + "By" + joinCleanNames(fields), true
+}
+
+// create Find<name>By<columns> for unique indexes and
+// List<name>By<columns> for the rest.
+func (md *Metadata) createFinders(strct Struct) {
+  lookups := finders(strct)
+  if len(lookups) == 0 {
+    return
+  }
+
+  md.Imports["context"] = true
+  md.Imports["database/sql"] = true
+
+  name := strct.CleanName
+  for _, lookup := range lookups {
+    fields, fn, ok := finderFunc(strct, lookup)
+    if !ok {
+      continue
+    }
+
+    params, args := md.params(fields)
+    query := md.selectSQL(strct) + " WHERE " + md.assignments(fields, " AND ", 1)
+    cols := strings.Join(lookup.columns, ", ")
+
+    if lookup.unique {
+      md.FinderCode.getFunc(
+        fmt.Sprintf("%s returns the row of %s with the given %s.", fn, strct.Name, cols),
+        fn, name, query, params, args)
+    } else {
+      md.FinderCode.listFunc(
+        fmt.Sprintf("%s returns the rows of %s with the given %s.", fn, strct.Name, cols),
+        fn, name, query, params, args)
+    }
+  }
+}
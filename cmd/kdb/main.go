@@ -3,6 +3,7 @@ package main
 import (
   "bytes"
   "database/sql"
+  "errors"
   goflag "flag"
   "fmt"
   _ "github.com/Go-SQL-Driver/MySQL"
@@ -25,6 +26,11 @@ mirroring the tables and fields.
 Usage: 
 
 \tkdb [OPTIONS] <db> <db connect string>
+\tkdb -ddl <file or directory> [OPTIONS] <db>
+\tkdb -from-schema schema.json [OPTIONS]
+\tkdb -config kdb.yaml [OPTIONS] [<db> <db connect string>]
+\tkdb diff [OPTIONS] <src> <dst>
+\tkdb migrate [OPTIONS] up|down|status|new ...
 
 Databases:
 
@@ -33,10 +39,12 @@ Databases:
 \tsqlite3   \thttp://github.com/mattn/go-sqlite3
 
 Consult the above links to see what the db connect string should be.
+Date and time columns are mapped to time.Time, so for mysql the connect
+string needs parseTime=true.
 
 Example db connect strings:
 
-\tmysql     \tuser:pass@tcp(host:port)/db
+\tmysql     \tuser:pass@tcp(host:port)/db?parseTime=true
 \tpostgresql\tuser=pqgotest dbname=pqgotest sslmode=verify-full
 \tsqlite3   \t./foo.db
 
@@ -49,38 +57,117 @@ Options:
 \t-output    <file>  \tset an output file
 \t                   \twhen not set, outputs to stdout
 \t-sqlstruct         \toutput structs that work with sqlstruct 
-\t                   \t(github.com/kisielk/sqlstruct)
+\t                   \t(github.com/kisielk/sqlstruct), the same as
+\t                   \tadding sql to -tags
+\t-tags <tags>       \tthe struct tags to output, e.g. "db,json:camel".
+\t                   \tEach tag holds the column name in a naming
+\t                   \tstyle given after a colon: asis (default),
+\t                   \tsnake, camel or pascal. The gorm tag always
+\t                   \tholds the column name as is, with primaryKey,
+\t                   \tautoIncrement, size and not null
+\t-omitempty         \tadd ,omitempty to the json, yaml, xml and toml
+\t                   \ttags of nullable columns
+\t-crud              \toutput Get<name>ByPK, Insert<name>, Update<name>,
+\t                   \tDelete<name> and List<name> functions
+\t-finders           \toutput Find<name>By<columns> functions for unique
+\t                   \tindexes and List<name>By<columns> functions for
+\t                   \tthe leading columns of all indexes
+\t-relations         \toutput methods following foreign keys, returning
+\t                   \tthe referenced row or the referencing rows
+\t-check             \tdo not write -output but compare it with what
+\t                   \twould be generated, ignoring the generated
+\t                   \tcomment at the top. Exits with 1 and prints a
+\t                   \tunified diff when they differ
+\t-verify            \toutput a <name>Schema constant per struct holding
+\t                   \tthe columns and types it was generated from,
+\t                   \tand a VerifySchema(ctx, db) function checking
+\t                   \tthe database against them with kdb.VerifySchema
 \t-omitgen           \tomit the generated comment at the top
+\t-initialisms <list>\tthe comma separated initialisms for the
+\t                   \tinitialisms format. default: those of golint
+\t                   \t(ID, URL, HTTP, JSON, ...)
+\t-collisions <mode> \twhat to do when names clash after formatting,
+\t                   \te.g. the columns user_id and userid, or a
+\t                   \tcolumn named args. values: suffix (number the
+\t                   \tlater names and print the clashes), fail
+\t                   \tdefault: suffix
+\t-template <path>   \ta text/template file, or a directory of *.tmpl
+\t                   \tfiles, to generate the code with instead of the
+\t                   \tbuilt in one. See template.go and
+\t                   \ttemplates/default.tmpl for what they can use
 \t-package <name>    \twhat the generated package should be
+\t-tables <patterns> \tonly output these tables. Patterns are comma
+\t                   \tseparated globs (e.g. "users,order_*") or a
+\t                   \tregular expression between slashes (e.g.
+\t                   \t"/^(users|orders)$/"), matched against the
+\t                   \ttable name and schema.table. May be repeated
+\t-exclude <patterns>\tdo not output these tables or views
+\t-views <patterns>  \tonly output these views. default: the views
+\t                   \tselected by -tables; -views= outputs none
+\t-matviews <patterns>\toutput these materialized views (postgresql)
+\t                   \tdefault: none
+\t-schema <name>     \tread the tables of this schema (postgresql) or
+\t                   \tdatabase (mysql) instead of the current one.
+\t                   \tMay be repeated; with more than one, struct
+\t                   \tnames are prefixed with the schema
+\t-ddl <path>        \tread the tables from SQL files instead of a
+\t                   \tdatabase: a file, or a directory whose *.sql
+\t                   \tfiles (but *.down.sql) are applied in name
+\t                   \torder. sqlite3 runs them in memory; mysql and
+\t                   \tpostgresql parse CREATE TABLE, ALTER TABLE,
+\t                   \tCREATE INDEX, DROP, RENAME and COMMENT ON and
+\t                   \tignore other statements, views included
+\t-dump-schema <file>\twrite the tables read (after -tables, -exclude,
+\t                   \t...) as versioned JSON to the file, or stdout
+\t                   \tfor -, instead of generating code. See
+\t                   \tschemaFile in dump.go
+\t-from-schema <file>\tgenerate from a -dump-schema file instead of a
+\t                   \tdatabase
+\t-config <file>     \ta YAML or JSON file setting the db, connect
+\t                   \tstring and options, and per table and column
+\t                   \tnames and types. See Config in config.go.
+\t                   \tThe other flags override it
 \t-types             \twhat the struct field types should be.
-\t                   \tvalues: base, null, pointer
+\t                   \tvalues: base, null, pointer, auto
+\t                   \tauto only makes nullable columns nullable
 \t                   \tdefault: base
+\t-nulltype          \thow null and auto represent nullable columns.
+\t                   \tvalues: sql (sql.Null*), pointer, kdb (kdb.Null[T])
+\t                   \tdefault: sql
+\t-nulltime          \thow nullable date/time columns are represented.
+\t                   \tvalues: sql (sql.NullTime), pointer (*time.Time),
+\t                   \tkdb (kdb.NullTime)
+\t                   \tdefault: the same as -nulltype
 
 Available formats are the following:
 
 \tcapitalize\tCapitalize the first letter of the name
 \tlowercase\tConvert the whole name to lower case
 \tnounderscore\tRemove all underscores
+\tcamel\tCapitalize the words between underscores and remove
+\t\tthe underscores: user_id is UserId
+\tinitialisms\tUpper case words that are initialisms: user_id is
+\t\tuser_ID, UserUrl is UserURL. See -initialisms
+\tsingular\tMake the last word singular: order_items is order_item
+
+Characters that can not be in a Go identifier become underscores,
+names that do not start with a letter get an X prefix and Go keywords
+get an underscore suffix, e.g. "2fa code" is X2facode with the
+default -fieldname.
 
 Note: the order of the formats specified matters. "lowercase,capitalize"
-is not the same as "capitalize,lowercase".
+is not the same as "capitalize,lowercase". For idiomatic Go names use
+-structname "singular,lowercase,camel,initialisms" and
+-fieldname "lowercase,camel,initialisms".
 
 Examples:
 
-\tkdb -output model.go mysql "user:pass@tcp(localhost:3306)/test?charset=utf8"
+\tkdb -output model.go mysql "user:pass@tcp(localhost:3306)/test?charset=utf8&parseTime=true"
 \tkdb sqlite3 "./foo.db"
 
 `
 )
 
-// var (
-//   BUILTINS = []string{"break", "default", "func", "interface", "select",
-//     "case", " defer", "go", "map", "struct",
-//     "chan", " else", " goto", " package", "switch",
-//     "const", "fallthrough", "if", "range", "type",
-//     "continue", "for", "import", "return", "var"}
-// )
-
 var (
   flag             = goflag.NewFlagSet(os.Args[0], goflag.ExitOnError)
   tabWidth         = flag.Int("tabwidth", 2, "tab width")
@@ -90,9 +177,39 @@ var (
   sqlstruct        = flag.Bool("sqlstruct", false, "")
   omitgen          = flag.Bool("omitgen", false, "")
   types            = flag.String("types", "base", "")
+  nullType         = flag.String("nulltype", "sql", "")
+  nullTime         = flag.String("nulltime", "", "")
+  crud             = flag.Bool("crud", false, "")
+  findersFlag      = flag.Bool("finders", false, "")
+  relations        = flag.Bool("relations", false, "")
   packge           = flag.String("package", "model", "")
+  templatePath     = flag.String("template", "", "")
+  configPath       = flag.String("config", "", "")
+  initialismsFlag  = flag.String("initialisms", "", "")
+  collisions       = flag.String("collisions", "suffix", "")
+  tagsFlag         = flag.String("tags", "", "")
+  omitempty        = flag.Bool("omitempty", false, "")
+  ddlPath          = flag.String("ddl", "", "")
+  check            = flag.Bool("check", false, "")
+  verify           = flag.Bool("verify", false, "")
+  dumpPath         = flag.String("dump-schema", "", "")
+  fromSchema       = flag.String("from-schema", "", "")
+
+  tables   patternsFlag
+  exclude  patternsFlag
+  views    patternsFlag
+  matviews patternsFlag
+  schemas  listFlag
 )
 
+func init() {
+  flag.Var(&tables, "tables", "")
+  flag.Var(&exclude, "exclude", "")
+  flag.Var(&views, "views", "")
+  flag.Var(&matviews, "matviews", "")
+  flag.Var(&schemas, "schema", "")
+}
+
 // capitalize the first letter of the string
 func capitalize(s string) string {
   if s == "" {
@@ -113,8 +230,11 @@ func nounderscore(s string) string {
 }
 
 // format a name based on the flags passed.
-// the order of the flags matter.
+// the order of the flags matter. Whatever the flags, the result
+// is a valid identifier.
 func formatName(n string, flags string) string {
+  n = identifierChars(n)
+
   formats := strings.Split(flags, ",")
   for _, f := range formats {
     switch f {
@@ -124,10 +244,16 @@ func formatName(n string, flags string) string {
       n = nounderscore(n)
     case "lowercase":
       n = lowercase(n)
+    case "camel":
+      n = camel(n)
+    case "initialisms":
+      n = initialisms(n)
+    case "singular":
+      n = singular(n)
     }
   }
 
-  return n
+  return identifier(n)
 }
 
 // format a struct name
@@ -158,6 +284,36 @@ func format(w io.Writer, code []byte) error {
   return nil
 }
 
+// the database/sql driver names of the dbs, where they differ
+var driverNames = map[string]string{"postgresql": "postgres"}
+
+// return the database/sql driver name of a db
+func driverName(db string) string {
+  if name, ok := driverNames[db]; ok {
+    return name
+  }
+  return db
+}
+
+// connect to the database and read its structs into md
+func introspect(md *Metadata, dsn string) error {
+  db, err := sql.Open(driverName(md.Dialect), dsn)
+  if err != nil {
+    return err
+  }
+  defer db.Close()
+
+  switch md.Dialect {
+  case "mysql":
+    return mysql(md, db)
+  case "postgresql":
+    return postgresql(md, db)
+  case "sqlite3":
+    return sqlite3(md, db)
+  }
+  return nil
+}
+
 func usage() {
   fmt.Fprint(os.Stderr, strings.Replace(helpMsg, "\\t", "\t", -1))
 }
@@ -171,37 +327,120 @@ func fatal(err error) {
 func main() {
   var err error
 
+  if len(os.Args) > 1 {
+    switch os.Args[1] {
+    case "diff":
+      os.Exit(diffCommand(os.Args[2:]))
+    case "migrate":
+      os.Exit(migrateCommand(os.Args[2:]))
+    }
+  }
+
   flag.Usage = usage
   flag.Parse(os.Args[1:])
 
-  if flag.NArg() != 2 {
-    flag.Usage()
-    os.Exit(1)
+  if *configPath != "" {
+    config, err = loadConfig(*configPath)
+    if err != nil {
+      fatal(err)
+    }
+    err = config.applyFlags(setFlags())
+    if err != nil {
+      fatal(err)
+    }
   }
 
-  db, err := sql.Open(flag.Arg(0), flag.Arg(1))
+  _, err = parseTags(*tagsFlag)
   if err != nil {
     fatal(err)
   }
+  if *check && *output == "" {
+    fatal(errors.New("-check needs -output"))
+  }
+
+  // with -ddl there is no connect string, and -from-schema needs
+  // neither as the dump records the db
+  driver, dsn := config.Driver, config.DSN
+  switch {
+  case flag.NArg() == 2:
+    driver, dsn = flag.Arg(0), flag.Arg(1)
+  case flag.NArg() == 1 && *ddlPath != "":
+    driver = flag.Arg(0)
+  case flag.NArg() != 0:
+    driver = ""
+  }
+  switch {
+  case *fromSchema != "" && (flag.NArg() != 0 || *ddlPath != ""):
+    fatal(errors.New("-from-schema takes neither a db nor -ddl"))
+  case *fromSchema == "" && (driver == "" || dsn == "" && *ddlPath == ""):
+    flag.Usage()
+    os.Exit(1)
+  }
 
   md := &Metadata{
     Package: *packge,
+    Dialect: driver,
     Args:    os.Args,
   }
 
-  switch flag.Arg(0) {
-  case "mysql":
-    err = mysql(md, db)
-  case "postgresql":
-    err = postgresql(md, db)
-  case "sqlite3":
-    err = sqlite3(md, db)
+  switch {
+  case *fromSchema != "":
+    err = loadSchema(md, *fromSchema)
+  case *ddlPath != "":
+    err = ddl(md, *ddlPath)
+  default:
+    err = introspect(md, dsn)
+  }
+  if err != nil {
+    fatal(err)
+  }
+  md.filter()
+
+  if *dumpPath != "" {
+    err = dumpSchema(md, *dumpPath)
+    if err != nil {
+      fatal(err)
+    }
+    os.Exit(0)
   }
 
+  config.apply(md)
+
+  clashes := md.resolveNames()
+  switch {
+  case *collisions != "suffix" && *collisions != "fail":
+    fatal(fmt.Errorf("unknown -collisions %q", *collisions))
+  case len(clashes) == 0:
+  case *collisions == "fail":
+    fatal(fmt.Errorf("%s", collisionReport(clashes)))
+  default:
+    fmt.Fprintln(os.Stderr, collisionReport(clashes))
+  }
+
+  buffer := &bytes.Buffer{}
+  err = md.Create().Output(buffer)
+  if err != nil {
+    fatal(err)
+  }
+  code := &bytes.Buffer{}
+  err = format(code, buffer.Bytes())
   if err != nil {
     fatal(err)
   }
 
+  if *check {
+    diff, err := checkOutput(*output, code.Bytes())
+    if err != nil {
+      fatal(err)
+    }
+    if diff != "" {
+      fmt.Print(diff)
+      fatal(fmt.Errorf("%s is out of date", *output))
+    }
+    os.Exit(0)
+  }
+
+  // created only now, so a failed run leaves it as it was
   file := os.Stdout
   if *output != "" {
     file, err = os.Create(*output)
@@ -212,26 +451,10 @@ func main() {
     defer file.Close()
   }
 
-  buffer := &bytes.Buffer{}
-  md.Create().Output(buffer)
-  err = format(file, buffer.Bytes())
+  _, err = code.WriteTo(file)
   if err != nil {
     fatal(err)
   }
 
-  // funcMap := template.FuncMap{
-  //   "format": format,
-  // }
-
-  // t, err := template.New("output").Funcs(funcMap).ParseFiles("output.tpl")
-  // if err != nil {
-  //   fatal(err)
-  // }
-
-  // err = t.ExecuteTemplate(file, "output.tpl", md.Create())
-  // if err != nil {
-  //   fatal(err)
-  // }
-
   os.Exit(0)
 }
@@ -2,10 +2,18 @@ package main
 
 import (
   "bytes"
+  "context"
   "database/sql"
+  "database/sql/driver"
   "fmt"
+  "github.com/kdar/kdb"
   _ "github.com/mattn/go-sqlite3"
+  "io"
   "os"
+  "path/filepath"
+  "reflect"
+  "strings"
+  "sync"
   "testing"
 )
 
@@ -53,15 +61,1489 @@ func TestSqlite3(t *testing.T) {
     }
   }
 
-  structs, err := sqlite3(db)
+  md := &Metadata{Package: "model"}
+  err = sqlite3(md, db)
   if err != nil {
     t.Fatal(err)
   }
+
+  *types = "auto"
+  defer func() { *types = "base" }()
+
+  byts := &bytes.Buffer{}
+  md.Create().Output(byts)
+  out := &bytes.Buffer{}
+  err = format(out, byts.Bytes())
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  for _, expect := range []string{
+    "Id   int64",
+    "Name sql.NullString",
+    "Productnameshort         sql.NullString",
+    "Replacedbydate           sql.NullTime",
+    `import "database/sql"`,
+  } {
+    if !strings.Contains(out.String(), expect) {
+      t.Errorf("expected %q in:\n%s", expect, out.String())
+    }
+  }
+
+  *nullTime = "pointer"
+  defer func() { *nullTime = "" }()
+
+  byts.Reset()
+  md.Create().Output(byts)
+  if !strings.Contains(byts.String(), "Onmarket *time.Time") || !strings.Contains(byts.String(), `import "time"`) {
+    t.Errorf("expected a *time.Time field in:\n%s", byts.String())
+  }
+}
+
+func TestParseMysqlType(t *testing.T) {
+  tests := []struct {
+    in, typ, sign string
+  }{
+    {"int(10) unsigned", "int", "unsigned"},
+    {"bigint(20)", "bigint", ""},
+    {"bigint unsigned zerofill", "bigint", "unsigned"},
+    {"enum('unsigned','a b')", "enum", ""},
+    {"datetime", "datetime", ""},
+  }
+  for _, test := range tests {
+    typ, sign := parseMysqlType(test.in)
+    if typ != test.typ || sign != test.sign {
+      t.Errorf("parseMysqlType(%q) = %q, %q; want %q, %q", test.in, typ, sign, test.typ, test.sign)
+    }
+  }
+
+  values := parseMysqlValues("enum('a','it''s','b,c')")
+  if strings.Join(values, "|") != "a|it's|b,c" {
+    t.Errorf("unexpected enum values %q", values)
+  }
+}
+
+func TestOutputComments(t *testing.T) {
+  md := &Metadata{
+    Package: "model",
+    Structs: []Struct{{
+      Name:      "users",
+      CleanName: "Users",
+      Comment:   "registered\nusers",
+      Fields: []Field{
+        {Name: "id", CleanName: "Id", Type: reflect.TypeOf(uint64(0)), Comment: "the id"},
+        {Name: "name", CleanName: "Name", Type: reflect.TypeOf("")},
+      },
+    }},
+  }
+
+  byts := &bytes.Buffer{}
+  md.Create().Output(byts)
+  out := &bytes.Buffer{}
+  err := format(out, byts.Bytes())
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  for _, expect := range []string{"// Users: registered users\n", "Id   uint64 // the id\n"} {
+    if !strings.Contains(out.String(), expect) {
+      t.Errorf("expected %q in:\n%s", expect, out.String())
+    }
+  }
+}
+
+func TestSqlite3Metadata(t *testing.T) {
+  os.Remove("./bar.db")
+  defer os.Remove("./bar.db")
+
+  db, err := sql.Open("sqlite3", "./bar.db")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer db.Close()
+
+  sqls := []string{
+    `create table customers (
+      id integer primary key autoincrement,
+      email nvarchar(100) not null default '',
+      code unsigned big int,
+      data,
+      price decimal(10,2))`,
+    "create unique index customers_email on customers (email)",
+    `create table orders (
+      id integer primary key,
+      customer_id integer not null references customers,
+      created datetime not null)`,
+    "create index orders_customer on orders (customer_id, created)",
+    "create view big_orders as select * from orders",
+  }
+  for _, sql := range sqls {
+    _, err = db.Exec(sql)
+    if err != nil {
+      t.Fatalf("%q: %s", err, sql)
+    }
+  }
+
+  md := &Metadata{}
+  err = sqlite3(md, db)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  if len(md.Structs) != 3 {
+    t.Fatalf("expected 3 structs (sqlite_sequence skipped), got %d", len(md.Structs))
+  }
+
+  views, customers, orders := md.Structs[0], md.Structs[1], md.Structs[2]
+  if !views.View || customers.View {
+    t.Error("expected only big_orders to be a view")
+  }
+
+  id, email, code, data, price := customers.Fields[0], customers.Fields[1], customers.Fields[2], customers.Fields[3], customers.Fields[4]
+  if !id.PrimaryKey || !id.AutoIncrement || id.Nullable {
+    t.Errorf("unexpected id field %+v", id)
+  }
+  if email.Type.Kind() != reflect.String || email.Length != 100 || email.Nullable || email.Default == nil || *email.Default != "''" {
+    t.Errorf("unexpected email field %+v", email)
+  }
+  if code.Type.Kind() != reflect.Int64 || !code.Unsigned {
+    t.Errorf("unexpected code field %+v", code)
+  }
+  if data.Type.Kind() != reflect.Slice || price.Type.Kind() != reflect.Float64 {
+    t.Errorf("unexpected data or price field %+v %+v", data, price)
+  }
+  if len(customers.Indexes) != 1 || !customers.Indexes[0].Unique || customers.Indexes[0].Columns[0] != "email" {
+    t.Errorf("unexpected customers indexes %+v", customers.Indexes)
+  }
+
+  if orders.Fields[2].Type != timeType {
+    t.Errorf("expected created to be a time.Time, got %s", orders.Fields[2].Type)
+  }
+  if len(orders.ForeignKeys) != 1 {
+    t.Fatalf("unexpected orders foreign keys %+v", orders.ForeignKeys)
+  }
+  fk := orders.ForeignKeys[0]
+  if fk.RefTable != "customers" || fk.Columns[0] != "customer_id" || len(fk.RefColumns) != 1 || fk.RefColumns[0] != "id" {
+    t.Errorf("unexpected foreign key %+v", fk)
+  }
+  if len(orders.Indexes) != 1 || orders.Indexes[0].Unique || len(orders.Indexes[0].Columns) != 2 {
+    t.Errorf("unexpected orders indexes %+v", orders.Indexes)
+  }
+}
+
+func TestCrud(t *testing.T) {
+  os.Remove("./crud.db")
+  defer os.Remove("./crud.db")
+
+  db, err := sql.Open("sqlite3", "./crud.db")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer db.Close()
+
+  sqls := []string{
+    "create table users (id integer primary key, type text not null, name text)",
+    "create table tags (user_id integer, tag text, note text, primary key (user_id, tag))",
+    "create table logs (msg text)",
+  }
+  for _, sql := range sqls {
+    _, err = db.Exec(sql)
+    if err != nil {
+      t.Fatalf("%q: %s", err, sql)
+    }
+  }
+
+  md := &Metadata{Package: "model", Dialect: "sqlite3"}
+  err = sqlite3(md, db)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  *crud = true
+  defer func() { *crud = false }()
+
+  byts := &bytes.Buffer{}
+  md.Create().Output(byts)
+  out := &bytes.Buffer{}
+  err = format(out, byts.Bytes())
+  if err != nil {
+    t.Fatalf("%s\n%s", err, byts.String())
+  }
+
+  for _, expect := range []string{
+    "func GetUsersByPK(ctx context.Context, q Querier, id int64) (*Users, error)",
+    `"SELECT \"id\", \"type\", \"name\" FROM \"users\" WHERE \"id\" = ?"`,
+    `"INSERT INTO \"users\" (\"type\", \"name\") VALUES (?, ?)", t.Type, t.Name)`,
+    "t.Id = int64(id)",
+    `"UPDATE \"tags\" SET \"note\" = ? WHERE \"user_id\" = ? AND \"tag\" = ?", t.Note, t.Userid, t.Tag)`,
+    "func DeleteTags(ctx context.Context, q Querier, userid int64, tag string) error",
+    "func ListLogs(ctx context.Context, q Querier) ([]Logs, error)",
+  } {
+    if !strings.Contains(out.String(), expect) {
+      t.Errorf("expected %q in:\n%s", expect, out.String())
+    }
+  }
+  if strings.Contains(out.String(), "GetLogsByPK") {
+    t.Error("expected no GetLogsByPK for a table without a primary key")
+  }
+
+  md.Dialect = "postgresql"
+  byts.Reset()
+  md.Create().Output(byts)
+  if !strings.Contains(byts.String(), `RETURNING \"id\"", t.Type, t.Name).Scan(&t.Id)`) {
+    t.Errorf("expected RETURNING for postgresql in:\n%s", byts.String())
+  }
+}
+
+func TestFinders(t *testing.T) {
+  md := &Metadata{Package: "model", Dialect: "sqlite3"}
+  md.Structs = []Struct{{
+    Name:      "orders",
+    CleanName: "Orders",
+    Fields: []Field{
+      {Name: "id", CleanName: "Id", Type: reflect.TypeOf(int64(0)), PrimaryKey: true},
+      {Name: "customer_id", CleanName: "Customerid", Type: reflect.TypeOf(int64(0))},
+      {Name: "number", CleanName: "Number", Type: reflect.TypeOf("")},
+    },
+    PrimaryKey: []string{"id"},
+    Indexes: []Index{
+      {Name: "pk", Columns: []string{"id"}, Unique: true, Primary: true},
+      {Name: "orders_number", Columns: []string{"customer_id", "number"}, Unique: true},
+      {Name: "orders_lower", Columns: []string{"", "number"}},
+    },
+  }}
+
+  *findersFlag = true
+  defer func() { *findersFlag = false }()
+
+  byts := &bytes.Buffer{}
+  md.Create().Output(byts)
+  out := &bytes.Buffer{}
+  err := format(out, byts.Bytes())
+  if err != nil {
+    t.Fatalf("%s\n%s", err, byts.String())
+  }
+
+  for _, expect := range []string{
+    "func FindOrdersById(ctx context.Context, q Querier, id int64) (*Orders, error)",
+    "func ListOrdersByCustomerid(ctx context.Context, q Querier, customerid int64) ([]Orders, error)",
+    "func FindOrdersByCustomeridAndNumber(ctx context.Context, q Querier, customerid int64, number string) (*Orders, error)",
+    `WHERE \"customer_id\" = ? AND \"number\" = ?", customerid, number)`,
+  } {
+    if !strings.Contains(out.String(), expect) {
+      t.Errorf("expected %q in:\n%s", expect, out.String())
+    }
+  }
+
+  *crud = true
+  defer func() { *crud = false }()
+  byts.Reset()
+  md.Create().Output(byts)
+  if strings.Contains(byts.String(), "FindOrdersById") || strings.Count(byts.String(), "ListOrdersByCustomerid(") != 1 {
+    t.Errorf("expected the primary key to be left to GetOrdersByPK in:\n%s", byts.String())
+  }
+}
+
+func TestRelations(t *testing.T) {
+  os.Remove("./rel.db")
+  defer os.Remove("./rel.db")
+
+  db, err := sql.Open("sqlite3", "./rel.db")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer db.Close()
+
+  sqls := []string{
+    "create table customers (id integer primary key, name text)",
+    `create table orders (
+      id integer primary key,
+      customer_id integer not null references customers (id),
+      shipper_id integer references customers (id))`,
+    "create table notes (order_id integer references orders)",
+  }
+  for _, sql := range sqls {
+    _, err = db.Exec(sql)
+    if err != nil {
+      t.Fatalf("%q: %s", err, sql)
+    }
+  }
+
+  *relations = true
+  defer func(f string) { *relations, *structNameFormat = false, f }(*structNameFormat)
+
+  // the referenced row is singular and the referencing rows plural,
+  // whatever the struct names
+  tests := []struct {
+    structName string
+    expect     []string
+  }{
+    {"capitalize,nounderscore", []string{
+      "Customerid int64 // references customers.id",
+      "func (t *Orders) CustomeridCustomer(ctx context.Context, q Querier) (*Customers, error)",
+      "func (t *Orders) ShipperidCustomer(ctx context.Context, q Querier) (*Customers, error)",
+      "func (t *Customers) OrdersByCustomerid(ctx context.Context, q Querier) ([]Orders, error)",
+      "func (t *Customers) OrdersByShipperid(ctx context.Context, q Querier) ([]Orders, error)",
+      "func (t *Notes) Order(ctx context.Context, q Querier) (*Orders, error)",
+      "func (t *Orders) Notes(ctx context.Context, q Querier) ([]Notes, error)",
+      `WHERE \"order_id\" = ?", t.Id)`,
+    }},
+    {"singular,camel", []string{
+      "func (t *Order) CustomeridCustomer(ctx context.Context, q Querier) (*Customer, error)",
+      "func (t *Customer) OrdersByCustomerid(ctx context.Context, q Querier) ([]Order, error)",
+      "func (t *Note) Order(ctx context.Context, q Querier) (*Order, error)",
+      "func (t *Order) Notes(ctx context.Context, q Querier) ([]Note, error)",
+    }},
+  }
+
+  for _, test := range tests {
+    *structNameFormat = test.structName
+    md := &Metadata{Package: "model", Dialect: "sqlite3"}
+    err = sqlite3(md, db)
+    if err != nil {
+      t.Fatal(err)
+    }
+
+    byts := &bytes.Buffer{}
+    md.Create().Output(byts)
+    out := &bytes.Buffer{}
+    err = format(out, byts.Bytes())
+    if err != nil {
+      t.Fatalf("%s\n%s", err, byts.String())
+    }
+
+    for _, expect := range test.expect {
+      if !strings.Contains(out.String(), expect) {
+        t.Errorf("%s: expected %q in:\n%s", test.structName, expect, out.String())
+      }
+    }
+  }
+}
+
+func TestStmts(t *testing.T) {
+  md := &Metadata{Package: "model", Dialect: "postgresql"}
+  md.Structs = []Struct{{
+    Name:      "user_accounts",
+    CleanName: "Useraccounts",
+    Fields: []Field{
+      {Name: "id", CleanName: "Id", Type: reflect.TypeOf(int64(0)), PrimaryKey: true},
+      {Name: "created_at", CleanName: "Createdat", Type: timeType},
+      {Name: "name", CleanName: "Name", Type: reflect.TypeOf("")},
+    },
+    PrimaryKey: []string{"id"},
+  }, {
+    Name:      "audit",
+    CleanName: "Audit",
+    Fields:    []Field{{Name: "msg", CleanName: "Msg", Type: reflect.TypeOf("")}},
+  }}
+
+  byts := &bytes.Buffer{}
+  md.Create().Output(byts)
+  out := &bytes.Buffer{}
+  err := format(out, byts.Bytes())
+  if err != nil {
+    t.Fatalf("%s\n%s", err, byts.String())
+  }
+
+  for _, expect := range []string{
+    `"Useraccounts": "INSERT INTO \"user_accounts\" (\"id\", \"created_at\", \"name\") VALUES ($1, $2, $3)"`,
+    `"Useraccounts": "SELECT \"id\", \"created_at\", \"name\" FROM \"user_accounts\""`,
+    `"Useraccounts": "UPDATE \"user_accounts\" SET \"created_at\" = $1, \"name\" = $2 WHERE \"id\" = $3"`,
+    `"Useraccounts": "DELETE FROM \"user_accounts\" WHERE \"id\" = $1"`,
+    `"INSERT INTO \"audit\" (\"msg\") VALUES ($1)"`,
+  } {
+    if !strings.Contains(out.String(), expect) {
+      t.Errorf("expected %q in:\n%s", expect, out.String())
+    }
+  }
+  if strings.Contains(out.String(), `UPDATE \"audit\"`) || strings.Contains(out.String(), `DELETE FROM \"audit\"`) {
+    t.Errorf("expected no update or delete statements without a primary key in:\n%s", out.String())
+  }
+
+  md.Dialect = "mysql"
+  byts.Reset()
+  md.Create().Output(byts)
+  if !strings.Contains(byts.String(), `"INSERT INTO `+"`user_accounts` (`id`, `created_at`, `name`)"+` VALUES (?, ?, ?)"`) {
+    t.Errorf("expected mysql quoting in:\n%s", byts.String())
+  }
+}
+
+func TestTemplate(t *testing.T) {
+  defer func() { *templatePath = "" }()
+
+  dir := t.TempDir()
+  md := &Metadata{Package: "model", Dialect: "sqlite3"}
+  md.Structs = []Struct{{
+    Name:      "users",
+    CleanName: "Users",
+    Fields: []Field{
+      {Name: "id", CleanName: "Id", Type: reflect.TypeOf(int64(0))},
+      {Name: "name", CleanName: "Name", Type: reflect.TypeOf(""), Nullable: true},
+    },
+  }}
+
+  // a file is executed itself
+  file := dir + "/names.tmpl"
+  err := os.WriteFile(file, []byte(`package {{.Package}}
+var Tables = []string{ {{- range .Structs}}{{printf "%q" (quote .Name)}},{{end -}} }
+{{range .Structs}}{{template "struct" .}}{{end}}`), 0644)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  *templatePath = file
+  byts := &bytes.Buffer{}
+  err = md.Create().Output(byts)
+  if err != nil {
+    t.Fatal(err)
+  }
+  out := &bytes.Buffer{}
+  err = format(out, byts.Bytes())
+  if err != nil {
+    t.Fatalf("%s\n%s", err, byts.String())
+  }
+  for _, expect := range []string{`var Tables = []string{"\"users\""}`, "type Users struct", "GENERATED"} {
+    if strings.Contains(out.String(), expect) != (expect != "GENERATED") {
+      t.Errorf("unexpected output for %q:\n%s", expect, out.String())
+    }
+  }
+
+  // a directory without main.tmpl redefines parts of the default
+  sub := dir + "/override"
+  os.Mkdir(sub, 0755)
+  err = os.WriteFile(sub+"/struct.tmpl", []byte(`{{define "struct"}}
+type {{.CleanName}} struct {
+{{- range .Fields}}
+  {{.CleanName}} {{goType .}} `+"`json:\"{{lowercase .Name}}\"`"+`
+{{- end}}
+}
+{{end}}`), 0644)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  *templatePath = sub
+  byts.Reset()
+  err = md.Create().Output(byts)
+  if err != nil {
+    t.Fatal(err)
+  }
+  out.Reset()
+  err = format(out, byts.Bytes())
+  if err != nil {
+    t.Fatalf("%s\n%s", err, byts.String())
+  }
+  for _, expect := range []string{"package model", "var SelectStmts", "Id   int64  `json:\"id\"`", "Name string `json:\"name\"`"} {
+    if !strings.Contains(out.String(), expect) {
+      t.Errorf("expected %q in:\n%s", expect, out.String())
+    }
+  }
+  if strings.Contains(out.String(), "func (t *Users) Args()") {
+    t.Errorf("expected the default struct template to be replaced in:\n%s", out.String())
+  }
+
+  // an empty directory is an error
+  *templatePath = t.TempDir()
+  if err := md.Create().Output(byts); err == nil {
+    t.Error("expected an error for a directory without templates")
+  }
+}
+
+func TestConfig(t *testing.T) {
+  defer func(p string, c, r, s bool, typ string) {
+    *packge, *crud, *relations, *sqlstruct, *types = p, c, r, s, typ
+    *tagsFlag = ""
+    exclude = patternsFlag{}
+  }(*packge, *crud, *relations, *sqlstruct, *types)
+
+  file := t.TempDir() + "/kdb.yaml"
+  err := os.WriteFile(file, []byte(`
+driver: sqlite3
+dsn: ./foo.db
+package: fromconfig
+types: auto
+crud: true
+relations: false
+tags: [sql]
+exclude: [audit_*]
+typemap:
+  decimal: string
+  users.balance: "*github.com/shopspring/decimal.Decimal"
+names:
+  users: Account
+  users.type: Kind
+`), 0644)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  c, err := loadConfig(file)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if c.Driver != "sqlite3" || c.DSN != "./foo.db" {
+    t.Errorf("unexpected driver and dsn: %q %q", c.Driver, c.DSN)
+  }
+
+  // -package was given on the command line
+  *packge = "fromflag"
+  err = c.applyFlags(map[string]bool{"package": true})
+  if err != nil {
+    t.Fatal(err)
+  }
+  if *packge != "fromflag" || *types != "auto" || !*crud || *relations || *tagsFlag != "sql" {
+    t.Errorf("unexpected flags: package %q, types %q, crud %v, relations %v, tags %q", *packge, *types, *crud, *relations, *tagsFlag)
+  }
+
+  md := &Metadata{Package: *packge, Dialect: "sqlite3"}
+  md.Structs = []Struct{{
+    Name:      "users",
+    CleanName: "Users",
+    Fields: []Field{
+      {Name: "id", CleanName: "Id", Type: reflect.TypeOf(int64(0)), SQLType: "INTEGER", PrimaryKey: true},
+      {Name: "type", CleanName: "Type", Type: reflect.TypeOf(""), SQLType: "TEXT"},
+      {Name: "balance", CleanName: "Balance", Type: reflect.TypeOf(float64(0)), SQLType: "DECIMAL(10,2)", Nullable: true},
+      {Name: "limit", CleanName: "Limit", Type: reflect.TypeOf(float64(0)), SQLType: "DECIMAL(10,2)"},
+    },
+    PrimaryKey: []string{"id"},
+  }, {
+    Name:      "audit_log",
+    CleanName: "Auditlog",
+    Fields:    []Field{{Name: "msg", CleanName: "Msg", Type: reflect.TypeOf("")}},
+  }}
+  md.filter()
+  c.apply(md)
+
+  byts := &bytes.Buffer{}
+  md.Create().Output(byts)
+  out := &bytes.Buffer{}
+  err = format(out, byts.Bytes())
+  if err != nil {
+    t.Fatalf("%s\n%s", err, byts.String())
+  }
+
+  for _, expect := range []string{
+    "package fromflag",
+    `import "github.com/shopspring/decimal"`,
+    "type Account struct",
+    "Kind    string           `sql:\"type\"`",
+    "Balance *decimal.Decimal `sql:\"balance\"`",
+    "Limit   string           `sql:\"limit\"`",
+    "func GetAccountByPK(",
+  } {
+    if !strings.Contains(out.String(), expect) {
+      t.Errorf("expected %q in:\n%s", expect, out.String())
+    }
+  }
+  if strings.Contains(out.String(), "Auditlog") {
+    t.Errorf("expected audit_log to be excluded in:\n%s", out.String())
+  }
+
+  os.WriteFile(file, []byte("package: x\nunknown: true\n"), 0644)
+  if _, err := loadConfig(file); err == nil {
+    t.Error("expected an error for an unknown key")
+  }
+}
+
+func TestFilter(t *testing.T) {
+  defer func() {
+    tables, exclude, views, matviews, schemas = patternsFlag{}, patternsFlag{}, patternsFlag{}, patternsFlag{}, nil
+  }()
+
+  structs := []Struct{
+    {Name: "users"},
+    {Name: "user_roles"},
+    {Name: "audit_log"},
+    {Name: "orders", Schema: "shop"},
+    {Name: "active_users", View: true},
+    {Name: "user_stats", View: true, Materialized: true},
+  }
+  filter := func() string {
+    md := &Metadata{Structs: structs}
+    md.filter()
+    var names []string
+    for _, strct := range md.Structs {
+      names = append(names, strct.Name)
+    }
+    return strings.Join(names, " ")
+  }
+
+  tests := []struct {
+    flags  []string
+    expect string
+  }{
+    {nil, "users user_roles audit_log orders active_users"},
+    {[]string{"-tables", "user*"}, "users user_roles"},
+    {[]string{"-tables", "users,shop.*"}, "users orders"},
+    {[]string{"-tables", "/^(users|audit_.{1,5})$/"}, "users audit_log"},
+    {[]string{"-exclude", "audit_*", "-exclude", "/roles$/"}, "users orders active_users"},
+    {[]string{"-tables", "users", "-views", "active_*"}, "users active_users"},
+    {[]string{"-views="}, "users user_roles audit_log orders"},
+    {[]string{"-views=", "-matviews", "*_stats"}, "users user_roles audit_log orders user_stats"},
+  }
+  for _, test := range tests {
+    tables, exclude, views, matviews = patternsFlag{}, patternsFlag{}, patternsFlag{}, patternsFlag{}
+    err := flag.Parse(test.flags)
+    if err != nil {
+      t.Fatal(err)
+    }
+    if got := filter(); got != test.expect {
+      t.Errorf("%v: expected %q, got %q", test.flags, test.expect, got)
+    }
+  }
+
+  var p patternsFlag
+  if err := p.Set("/(/"); err == nil {
+    t.Error("expected an error for a bad regular expression")
+  }
+  if err := p.Set("/^a/"); err != nil || !p.match("ab") || p.match("ba") {
+    t.Errorf("expected a regular expression to match, got %v", err)
+  }
+
+  md := &Metadata{Dialect: "postgresql"}
+  if where, args := md.inSchemas("n.nspname", "current_schema()"); where != "n.nspname = current_schema()" || len(args) != 0 {
+    t.Errorf("unexpected schema condition %q %v", where, args)
+  }
+  flag.Parse([]string{"-schema", "public,shop", "-schema", "audit"})
+  if where, args := md.inSchemas("n.nspname", "current_schema()"); where != "n.nspname IN ($1, $2, $3)" || len(args) != 3 {
+    t.Errorf("unexpected schema condition %q %v", where, args)
+  }
+  if name := tableStructName("shop", "orders"); name != "Shoporders" {
+    t.Errorf("expected Shoporders, got %q", name)
+  }
+
+  strct := Struct{Name: "orders", Schema: "shop", Fields: []Field{{Name: "id"}}}
+  if got := md.selectSQL(strct); got != `SELECT "id" FROM "shop"."orders"` {
+    t.Errorf("unexpected select %q", got)
+  }
+}
+
+func TestFormatName(t *testing.T) {
+  defer func() { *initialismsFlag = "" }()
+
+  tests := []struct {
+    name, formats, expect string
+  }{
+    {"user_id", "lowercase,capitalize,nounderscore", "Userid"},
+    {"user_id", "camel", "UserId"},
+    {"user_id", "camel,initialisms", "UserID"},
+    {"api_url", "initialisms,camel", "APIURL"},
+    {"HttpServerId", "initialisms", "HTTPServerID"},
+    {"users", "singular,camel", "User"},
+    {"order_items", "singular,camel", "OrderItem"},
+    {"OrderAddresses", "singular", "OrderAddress"},
+    {"categories", "singular,camel", "Category"},
+    {"people", "singular,camel", "Person"},
+    {"status", "singular,camel", "Status"},
+    {"boxes", "singular", "box"},
+    {"USERS", "singular", "USER"},
+    {"type", "lowercase", "type_"},
+    {"func", "", "func_"},
+    {"2fa_code", "lowercase,capitalize,nounderscore", "X2facode"},
+    {"first name", "camel", "FirstName"},
+    {"unit-price", "lowercase,camel", "UnitPrice"},
+    {"", "camel", "X"},
+  }
+  for _, test := range tests {
+    if got := formatName(test.name, test.formats); got != test.expect {
+      t.Errorf("formatName(%q, %q): expected %q, got %q", test.name, test.formats, test.expect, got)
+    }
+  }
+
+  for name, expect := range map[string]string{"Order": "Orders", "Orders": "Orders", "OrderItem": "OrderItems",
+    "Category": "Categories", "Day": "Days", "UserAddress": "UserAddresses", "Box": "Boxes", "Person": "People",
+    "Status": "Status", "USER": "USERS", "order_item": "order_items"} {
+    if got := plural(name); got != expect {
+      t.Errorf("plural(%q): expected %q, got %q", name, expect, got)
+    }
+  }
+
+  for name, expect := range map[string]string{"ID": "id", "URLPath": "urlPath", "UserID": "userID", "Type": "type_", "T": "t_"} {
+    if got := paramName(name); got != expect {
+      t.Errorf("paramName(%q): expected %q, got %q", name, expect, got)
+    }
+  }
+
+  *initialismsFlag = "SKU,ID"
+  if got := formatName("product_sku_url", "camel,initialisms"); got != "ProductSKUUrl" {
+    t.Errorf("expected ProductSKUUrl, got %q", got)
+  }
+}
+
+func TestCollisions(t *testing.T) {
+  defer func(c, r bool) { *crud, *relations = c, r }(*crud, *relations)
+  *crud, *relations = true, true
+
+  id := Field{Name: "id", CleanName: "Id", Type: reflect.TypeOf(int64(0)), PrimaryKey: true}
+  md := &Metadata{Package: "model", Dialect: "sqlite3"}
+  md.Structs = []Struct{{
+    Name:      "arger",
+    CleanName: formatStructName("arger"),
+    Fields:    []Field{id},
+  }, {
+    Name:       "customers",
+    CleanName:  formatStructName("customers"),
+    Fields:     []Field{id},
+    PrimaryKey: []string{"id"},
+  }, {
+    Name:      "order_item",
+    CleanName: formatStructName("order_item"),
+    Fields: []Field{
+      id,
+      {Name: "user_id", CleanName: formatFieldName("user_id"), Type: reflect.TypeOf(int64(0))},
+      {Name: "userid", CleanName: formatFieldName("userid"), Type: reflect.TypeOf(int64(0))},
+      {Name: "args", CleanName: formatFieldName("args"), Type: reflect.TypeOf("")},
+      {Name: "customer", CleanName: formatFieldName("customer"), Type: reflect.TypeOf(int64(0))},
+    },
+    PrimaryKey:  []string{"id"},
+    ForeignKeys: []ForeignKey{{Columns: []string{"customer"}, RefTable: "customers", RefColumns: []string{"id"}}},
+  }, {
+    Name:       "orderitem",
+    CleanName:  formatStructName("orderitem"),
+    Fields:     []Field{id},
+    PrimaryKey: []string{"id"},
+  }, {
+    Name:      "list_orderitem",
+    CleanName: "ListOrderitem",
+    Fields:    []Field{id},
+  }}
+
+  clashes := md.resolveNames()
+  expect := []string{
+    "table order_item: the field Userid of column userid clashes with the field of column user_id; it is Userid2",
+    "table order_item: the field Args of column args clashes with the Args method; it is Args2",
+    "table arger: Arger clashes with the generated Arger; the struct is Arger2",
+    "table orderitem: Orderitem clashes with the struct of table order_item; the struct is Orderitem2",
+    "table list_orderitem: ListOrderitem clashes with ListOrderitem of table order_item; the struct is ListOrderitem3",
+    "table order_item: the relation method Customer to customers clashes with the field of column customer; it is Customer2",
+  }
+  if strings.Join(clashes, "\n") != strings.Join(expect, "\n") {
+    t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(expect, "\n"), strings.Join(clashes, "\n"))
+  }
+
+  byts := &bytes.Buffer{}
+  md.Create().Output(byts)
+  out := &bytes.Buffer{}
+  err := format(out, byts.Bytes())
+  if err != nil {
+    t.Fatalf("%s\n%s", err, byts.String())
+  }
+  for _, expect := range []string{
+    "type Arger2 struct",
+    "type Orderitem2 struct",
+    "Userid2  int64",
+    "Args2    string",
+    "func (t *Orderitem) Customer2(",
+  } {
+    if !strings.Contains(out.String(), expect) {
+      t.Errorf("expected %q in:\n%s", expect, out.String())
+    }
+  }
+
+  // resolving again only finds the relation method, which is named
+  // when it is generated
+  if clashes := md.resolveNames(); len(clashes) != 1 {
+    t.Errorf("expected one clash, got %v", clashes)
+  }
+}
+
+func TestTags(t *testing.T) {
+  defer func(s bool) { *tagsFlag, *omitempty, *sqlstruct = "", false, s }(*sqlstruct)
+
+  id := Field{Name: "user_id", Type: reflect.TypeOf(int64(0)), PrimaryKey: true, AutoIncrement: true}
+  name := Field{Name: "FullName", Type: reflect.TypeOf(""), Nullable: true, Length: 255}
+  code := Field{Name: "zip_code", Type: reflect.TypeOf("")}
+
+  tests := []struct {
+    tags      string
+    omitempty bool
+    field     Field
+    expect    string
+  }{
+    {"", false, id, ""},
+    {"db", false, id, "`db:\"user_id\"`"},
+    {"db,json:camel,yaml:snake,xml:pascal", false, id, "`db:\"user_id\" json:\"userId\" yaml:\"user_id\" xml:\"UserId\"`"},
+    {"json:snake,yaml", true, name, "`json:\"full_name,omitempty\" yaml:\"FullName,omitempty\"`"},
+    {"json,db", true, code, "`json:\"zip_code\" db:\"zip_code\"`"},
+    {"gorm", false, id, "`gorm:\"column:user_id;primaryKey;autoIncrement\"`"},
+    {"gorm:snake,json:camel", false, name, "`gorm:\"column:FullName;size:255\" json:\"fullName\"`"},
+    {"gorm", false, code, "`gorm:\"column:zip_code;not null\"`"},
+  }
+  for _, test := range tests {
+    *tagsFlag, *omitempty = test.tags, test.omitempty
+    if got := fieldTag(test.field); got != test.expect {
+      t.Errorf("%q: expected %s, got %s", test.tags, test.expect, got)
+    }
+  }
+
+  *tagsFlag, *sqlstruct = "json", true
+  if got := fieldTag(code); got != "`json:\"zip_code\" sql:\"zip_code\"`" {
+    t.Errorf("unexpected tag with -sqlstruct: %s", got)
+  }
+
+  for _, bad := range []string{"json:kebab", ":snake", "a\"b"} {
+    if _, err := parseTags(bad); err == nil {
+      t.Errorf("expected an error for %q", bad)
+    }
+  }
+}
+
+func TestDDL(t *testing.T) {
+  dir := t.TempDir()
+  files := map[string]string{
+    "001_init.sql": `-- customers and their orders
+      create table customers (
+        id integer primary key autoincrement,
+        email varchar(100) not null default '',
+        note text);
+      create table orders (
+        id integer primary key,
+        customer_id integer not null references customers,
+        total decimal(10,2));`,
+    "002_index.sql":      "alter table orders add column created datetime; create index orders_created on orders (created);",
+    "002_index.down.sql": "drop index orders_created; alter table orders drop column created;",
+  }
+  for name, sql := range files {
+    err := os.WriteFile(dir+"/"+name, []byte(sql), 0644)
+    if err != nil {
+      t.Fatal(err)
+    }
+  }
+
+  // sqlite3 runs the files in memory, so it reads the same as a live
+  // database they were run against
+  os.Remove("./ddl.db")
+  defer os.Remove("./ddl.db")
+  db, err := sql.Open("sqlite3", "./ddl.db")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer db.Close()
+  for _, name := range []string{"001_init.sql", "002_index.sql"} {
+    _, err = db.Exec(files[name])
+    if err != nil {
+      t.Fatal(err)
+    }
+  }
+  live := &Metadata{Dialect: "sqlite3"}
+  err = sqlite3(live, db)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  md := &Metadata{Dialect: "sqlite3"}
+  err = ddl(md, dir)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if !reflect.DeepEqual(md.Structs, live.Structs) {
+    t.Errorf("expected:\n%+v\ngot:\n%+v", live.Structs, md.Structs)
+  }
+
+  mysqlDDL := "CREATE TABLE `customers` (\n" +
+    "  `id` int(11) unsigned NOT NULL AUTO_INCREMENT,\n" +
+    "  `email` varchar(100) NOT NULL DEFAULT '' COMMENT 'login',\n" +
+    "  `active` boolean DEFAULT TRUE,\n" +
+    "  `balance` numeric(10,2) DEFAULT 0,\n" +
+    "  `kind` enum('a','b''s') NOT NULL,\n" +
+    "  `created` timestamp NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,\n" +
+    "  PRIMARY KEY (`id`),\n" +
+    "  UNIQUE KEY (`email`)\n" +
+    ") ENGINE=InnoDB COMMENT='the customers';\n" +
+    "CREATE TABLE orders (\n" +
+    "  id BIGINT PRIMARY KEY,\n" +
+    "  customer_id INT UNSIGNED,\n" +
+    "  note TEXT,\n" +
+    "  FOREIGN KEY (customer_id) REFERENCES customers (id) ON DELETE CASCADE\n" +
+    ");\n" +
+    "ALTER TABLE orders ADD COLUMN code CHAR, ADD INDEX (note(10), code);\n" +
+    "/* views are ignored */ CREATE VIEW v AS SELECT 1;"
+  err = os.WriteFile(dir+"/mysql.ddl", []byte(mysqlDDL), 0644)
+  if err != nil {
+    t.Fatal(err)
+  }
+  md = &Metadata{Dialect: "mysql"}
+  err = ddl(md, dir+"/mysql.ddl")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(md.Structs) != 2 || md.Structs[0].Comment != "the customers" {
+    t.Fatalf("unexpected structs %+v", md.Structs)
+  }
+
+  customers, orders := md.Structs[0], md.Structs[1]
+  for i, expect := range []string{
+    "{id int unsigned uint64 false true <nil> }",
+    "{email varchar(100) string false false  login}",
+    "{active tinyint(1) int64 true false 1 }",
+    "{balance decimal(10,2) float64 true false 0.00 }",
+    "{kind enum('a','b''s') string false false <nil> }",
+    "{created timestamp time.Time true false CURRENT_TIMESTAMP }",
+    "{id bigint int64 false false <nil> }",
+    "{customer_id int unsigned uint64 true false <nil> }",
+    "{note text string true false <nil> }",
+    "{code char(1) string true false <nil> }",
+  } {
+    f := append(customers.Fields, orders.Fields...)[i]
+    def := "<nil>"
+    if f.Default != nil {
+      def = *f.Default
+    }
+    got := fmt.Sprintf("{%s %s %s %v %v %s %s}", f.Name, f.SQLType, f.Type, f.Nullable, f.AutoIncrement, def, f.Comment)
+    if got != expect {
+      t.Errorf("expected %s, got %s", expect, got)
+    }
+  }
+  if kind := customers.Fields[4]; len(kind.Values) != 2 || kind.Values[1] != "b's" || kind.Length != 3 {
+    t.Errorf("unexpected enum field %+v", kind)
+  }
+  if fmt.Sprint(customers.Indexes) != "[{email [email] true false} {PRIMARY [id] true true}]" {
+    t.Errorf("unexpected customers indexes %+v", customers.Indexes)
+  }
+  if fmt.Sprint(orders.Indexes) != "[{customer_id [customer_id] false false} {note [note code] false false} {PRIMARY [id] true true}]" {
+    t.Errorf("unexpected orders indexes %+v", orders.Indexes)
+  }
+  if fmt.Sprint(orders.ForeignKeys) != "[{orders_ibfk_1 [customer_id]  customers [id] NO ACTION CASCADE}]" {
+    t.Errorf("unexpected orders foreign keys %+v", orders.ForeignKeys)
+  }
+
+  pgDDL := `CREATE TABLE public.customers (
+      id serial PRIMARY KEY,
+      email character varying(100) NOT NULL DEFAULT '',
+      "Name" text,
+      score double precision DEFAULT -1,
+      created timestamp with time zone DEFAULT now(),
+      tags text[],
+      CONSTRAINT customers_email UNIQUE (email)
+    );
+    COMMENT ON TABLE customers IS 'the customers';
+    COMMENT ON COLUMN customers.email IS 'login';
+    CREATE TABLE orders (
+      id bigint GENERATED ALWAYS AS IDENTITY,
+      customer_id integer REFERENCES customers ON DELETE SET NULL,
+      code char(3),
+      PRIMARY KEY (id)
+    );
+    CREATE INDEX ON orders (customer_id, lower(code));
+    CREATE FUNCTION f() RETURNS trigger AS $$ BEGIN; END; $$ LANGUAGE plpgsql;
+    CREATE TABLE other.ignored (id int);`
+  err = os.WriteFile(dir+"/pg.ddl", []byte(pgDDL), 0644)
+  if err != nil {
+    t.Fatal(err)
+  }
+  md = &Metadata{Dialect: "postgresql"}
+  err = ddl(md, dir+"/pg.ddl")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(md.Structs) != 2 || md.Structs[0].Comment != "the customers" {
+    t.Fatalf("unexpected structs %+v", md.Structs)
+  }
+
+  customers, orders = md.Structs[0], md.Structs[1]
+  for i, expect := range []string{
+    "{id integer int64 false true nextval('customers_id_seq'::regclass)}",
+    "{email character varying(100) string false false ''::character varying}",
+    "{Name text string true false <nil>}",
+    "{score double precision float64 true false '-1'::double precision}",
+    "{created timestamp with time zone time.Time true false now()}",
+    "{tags text[] string true false <nil>}",
+    "{id bigint int64 false true <nil>}",
+    "{customer_id integer int64 true false <nil>}",
+    "{code character(3) string true false <nil>}",
+  } {
+    f := append(customers.Fields, orders.Fields...)[i]
+    def := "<nil>"
+    if f.Default != nil {
+      def = *f.Default
+    }
+    got := fmt.Sprintf("{%s %s %s %v %v %s}", f.Name, f.SQLType, f.Type, f.Nullable, f.AutoIncrement, def)
+    if got != expect {
+      t.Errorf("expected %s, got %s", expect, got)
+    }
+  }
+  if customers.Fields[1].Comment != "login" || orders.Fields[2].Length != 3 {
+    t.Errorf("unexpected comment or length %+v %+v", customers.Fields[1], orders.Fields[2])
+  }
+  if fmt.Sprint(customers.Indexes) != "[{customers_email [email] true false} {customers_pkey [id] true true}]" {
+    t.Errorf("unexpected customers indexes %+v", customers.Indexes)
+  }
+  if fmt.Sprint(orders.Indexes) != "[{orders_customer_id_expr_idx [customer_id ] false false} {orders_pkey [id] true true}]" {
+    t.Errorf("unexpected orders indexes %+v", orders.Indexes)
+  }
+  if fmt.Sprint(orders.ForeignKeys) != "[{orders_customer_id_fkey [customer_id]  customers [id] NO ACTION SET NULL}]" {
+    t.Errorf("unexpected orders foreign keys %+v", orders.ForeignKeys)
+  }
+}
+
+func TestCheck(t *testing.T) {
+  lines := func(s string) []string { return codeLines(s) }
+
+  if diff := unifiedDiff("a", "b", lines("x\ny\n"), lines("x\ny\n")); diff != "" {
+    t.Errorf("expected no diff, got:\n%s", diff)
+  }
+
+  old := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+  gen := "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n"
+  expect := "--- a\n+++ b\n" +
+    "@@ -1,6 +1,6 @@\n 1\n 2\n-3\n+three\n 4\n 5\n 6\n" +
+    "@@ -10,3 +10,4 @@\n 10\n 11\n 12\n+13\n"
+  if diff := unifiedDiff("a", "b", lines(old), lines(gen)); diff != expect {
+    t.Errorf("expected:\n%s\ngot:\n%s", expect, diff)
+  }
+
+  dir := t.TempDir()
+  path := dir + "/model.go"
+  err := os.WriteFile(path, []byte("// GENERATED BY dbtogo (github.com/kdar/dbtogo); DO NOT EDIT\n// ---args: kdb -output old.go\npackage model\n\ntype A struct{}\n"), 0644)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  diff, err := checkOutput(path, []byte("// GENERATED BY dbtogo (github.com/kdar/dbtogo); DO NOT EDIT\n// ---args: kdb -check\npackage model\n\ntype A struct{}\n"))
+  if err != nil || diff != "" {
+    t.Errorf("expected the header to be ignored, got %v:\n%s", err, diff)
+  }
+
+  diff, err = checkOutput(path, []byte("package model\n\ntype B struct{}\n"))
+  if err != nil || !strings.Contains(diff, "-type A struct{}\n+type B struct{}\n") {
+    t.Errorf("expected a diff, got %v:\n%s", err, diff)
+  }
+
+  diff, err = checkOutput(dir+"/missing.go", []byte("package model\n"))
+  if err != nil || !strings.Contains(diff, "@@ -0,0 +1 @@\n+package model\n") {
+    t.Errorf("expected a diff for a missing file, got %v:\n%s", err, diff)
+  }
+
+  // the edit scripts are the shortest: as long as a and b less twice
+  // their longest common subsequence
+  words := strings.Fields("a b c a b b a c")
+  for i := 0; i < 200; i++ {
+    var a, b []string
+    for j := 0; j < i%9; j++ {
+      a = append(a, words[(i*7+j*3)%len(words)])
+    }
+    for j := 0; j < i%7; j++ {
+      b = append(b, words[(i*5+j*j)%len(words)])
+    }
+
+    var gotA, gotB []string
+    edits := 0
+    for _, op := range diffLines(a, b) {
+      if op.kind != '+' {
+        gotA = append(gotA, op.line)
+      }
+      if op.kind != '-' {
+        gotB = append(gotB, op.line)
+      }
+      if op.kind != ' ' {
+        edits++
+      }
+    }
+    if strings.Join(gotA, " ") != strings.Join(a, " ") || strings.Join(gotB, " ") != strings.Join(b, " ") {
+      t.Fatalf("%q -> %q: bad edit script", a, b)
+    }
+
+    lcs := make([][]int, len(a)+1)
+    for x := range lcs {
+      lcs[x] = make([]int, len(b)+1)
+    }
+    for x := len(a) - 1; x >= 0; x-- {
+      for y := len(b) - 1; y >= 0; y-- {
+        switch {
+        case a[x] == b[y]:
+          lcs[x][y] = lcs[x+1][y+1] + 1
+        case lcs[x+1][y] > lcs[x][y+1]:
+          lcs[x][y] = lcs[x+1][y]
+        default:
+          lcs[x][y] = lcs[x][y+1]
+        }
+      }
+    }
+    if expect := len(a) + len(b) - 2*lcs[0][0]; edits != expect {
+      t.Errorf("%q -> %q: expected %d edits, got %d", a, b, expect, edits)
+    }
+  }
+}
+
+func TestVerify(t *testing.T) {
+  defer func() { *verify = false }()
+  *verify = true
+
+  strct := Struct{
+    Name:      "order items",
+    Schema:    "sales",
+    CleanName: "OrderItems",
+    Fields: []Field{
+      {Name: "id", CleanName: "Id", Type: reflect.TypeOf(int64(0)), SQLType: "bigint"},
+      {Name: `a "b"`, CleanName: "AB", Type: reflect.TypeOf(""), SQLType: "numeric(10,2)", Nullable: true},
+    },
+  }
+  if fp := fingerprint(strct); fp != `sales."order items"(id bigint, "a ""b""" numeric(10,2)?)` {
+    t.Errorf("unexpected fingerprint %s", fp)
+  }
+
+  md := &Metadata{Package: "model", Dialect: "postgresql", Structs: []Struct{strct}}
   byts := &bytes.Buffer{}
-  *omitgen = true
-  generate(byts, structs)
-  err = format(byts, byts.Bytes())
+  err := md.Create().Output(byts)
   if err != nil {
     t.Fatal(err)
   }
+  out := &bytes.Buffer{}
+  err = format(out, byts.Bytes())
+  if err != nil {
+    t.Fatalf("%s\n%s", err, byts.String())
+  }
+  for _, expect := range []string{
+    `import "github.com/kdar/kdb"`,
+    "const OrderItemsSchema = \"sales.\\\"order items\\\"(id bigint, \\\"a \\\"\\\"b\\\"\\\"\\\" numeric(10,2)?)\"",
+    "func VerifySchema(ctx context.Context, db kdb.Querier) error {",
+    "return kdb.VerifySchema(ctx, db, \"postgresql\",\n    OrderItemsSchema,\n  )",
+  } {
+    if !strings.Contains(out.String(), expect) {
+      t.Errorf("expected %q in:\n%s", expect, out.String())
+    }
+  }
+
+  md.Structs = append(md.Structs, Struct{Name: "verify_schema", CleanName: "VerifySchema"})
+  if clashes := md.resolveNames(); len(clashes) != 1 || md.Structs[1].CleanName != "VerifySchema2" {
+    t.Errorf("expected VerifySchema to be reserved, got %v", clashes)
+  }
+
+  // the fingerprint of a database verifies against it, even with a
+  // column without a type
+  db, err := sql.Open("sqlite3", ":memory:")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer db.Close()
+  db.SetMaxOpenConns(1)
+  if _, err = db.Exec("create table t (id integer, a, b text)"); err != nil {
+    t.Fatal(err)
+  }
+  md = &Metadata{Package: "model", Dialect: "sqlite3"}
+  if err = sqlite3(md, db); err != nil {
+    t.Fatal(err)
+  }
+  fp := fingerprint(md.Structs[0])
+  if fp != `t(id INTEGER?, a ""?, b TEXT?)` {
+    t.Errorf("unexpected fingerprint %s", fp)
+  }
+  if err = kdb.VerifySchema(context.Background(), db, "sqlite3", fp); err != nil {
+    t.Error(err)
+  }
+}
+
+func TestDumpSchema(t *testing.T) {
+  db, err := sql.Open("sqlite3", ":memory:")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer db.Close()
+  db.SetMaxOpenConns(1)
+
+  _, err = db.Exec(`create table customers (
+      id integer primary key,
+      email varchar(100) not null default '',
+      data blob,
+      created datetime);
+    create table orders (
+      id integer primary key,
+      customer_id integer references customers on delete cascade,
+      total decimal(10,2),
+      paid boolean);
+    create index orders_customer on orders (customer_id);`)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  md := &Metadata{Dialect: "sqlite3"}
+  err = sqlite3(md, db)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  path := t.TempDir() + "/schema.json"
+  err = dumpSchema(md, path)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  loaded := &Metadata{}
+  err = loadSchema(loaded, path)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if loaded.Dialect != "sqlite3" || !reflect.DeepEqual(loaded.Structs, md.Structs) {
+    t.Errorf("expected:\n%+v\ngot:\n%+v", md.Structs, loaded.Structs)
+  }
+
+  for _, bad := range []string{`{"tables": []}`, `{"version": 99, "tables": []}`,
+    `{"version": 1, "tables": [{"name": "t", "columns": [{"name": "c", "type": "complex128"}]}]}`} {
+    os.WriteFile(path, []byte(bad), 0644)
+    if err := loadSchema(&Metadata{}, path); err == nil {
+      t.Errorf("expected an error for %s", bad)
+    }
+  }
+}
+
+func TestSchemaDiff(t *testing.T) {
+  dir := t.TempDir()
+  src, dst := dir+"/src.sql", dir+"/dst.sql"
+  os.WriteFile(src, []byte(`create table users (
+      id serial primary key,
+      email varchar(100),
+      nick text);
+    create table legacy (x int);
+    create index users_nick on users (nick);`), 0644)
+  os.WriteFile(dst, []byte(`create table orgs (
+      id bigint generated by default as identity primary key,
+      name text not null);
+    create table users (
+      id serial primary key,
+      email varchar(200) not null default '',
+      org_id bigint references orgs on delete cascade);
+    create unique index users_email on users (email);`), 0644)
+
+  tests := []struct {
+    dialect string
+    text    string
+    sql     []string
+  }{
+    {"postgresql", `- table legacy
++ table orgs
+~ table users
+  ~ column email: type character varying(100) -> character varying(200), nullable -> NOT NULL, default none -> ''::character varying
+  - column nick text
+  + column org_id bigint
+  - index users_nick (nick)
+  + index users_email unique (email)
+  + foreign key users_org_id_fkey (org_id) -> orgs (id) ON UPDATE NO ACTION ON DELETE CASCADE
+`, []string{
+      `ALTER TABLE "users" DROP CONSTRAINT IF EXISTS "users_nick"`,
+      `DROP INDEX IF EXISTS "users_nick"`,
+      `DROP TABLE "legacy"`,
+      "CREATE TABLE \"orgs\" (\n  \"id\" bigint GENERATED BY DEFAULT AS IDENTITY NOT NULL,\n  \"name\" text NOT NULL,\n  PRIMARY KEY (\"id\")\n)",
+      `ALTER TABLE "users" ALTER COLUMN "email" TYPE character varying(200) USING "email"::character varying(200)`,
+      `ALTER TABLE "users" ALTER COLUMN "email" SET NOT NULL`,
+      `ALTER TABLE "users" ALTER COLUMN "email" SET DEFAULT ''::character varying`,
+      `ALTER TABLE "users" DROP COLUMN "nick"`,
+      `ALTER TABLE "users" ADD COLUMN "org_id" bigint`,
+      `CREATE UNIQUE INDEX "users_email" ON "users" ("email")`,
+      `ALTER TABLE "users" ADD CONSTRAINT "users_org_id_fkey" FOREIGN KEY ("org_id") REFERENCES "orgs" ("id") ON UPDATE NO ACTION ON DELETE CASCADE`,
+    }},
+    {"mysql", `- table legacy
++ table orgs
+~ table users
+  ~ column email: type varchar(100) -> varchar(200), nullable -> NOT NULL, default none -> ''
+  - column nick text
+  + column org_id bigint
+  - index users_nick (nick)
+  + index org_id (org_id)
+  + index users_email unique (email)
+  + foreign key users_ibfk_1 (org_id) -> orgs (id) ON UPDATE NO ACTION ON DELETE CASCADE
+`, []string{
+      "DROP INDEX `users_nick` ON `users`",
+      "DROP TABLE `legacy`",
+      "CREATE TABLE `orgs` (\n  `id` bigint NOT NULL AUTO_INCREMENT,\n  `name` text NOT NULL,\n  PRIMARY KEY (`id`)\n)",
+      "ALTER TABLE `users` MODIFY COLUMN `email` varchar(200) NOT NULL DEFAULT ''",
+      "ALTER TABLE `users` DROP COLUMN `nick`",
+      "ALTER TABLE `users` ADD COLUMN `org_id` bigint",
+      "CREATE INDEX `org_id` ON `users` (`org_id`)",
+      "CREATE UNIQUE INDEX `users_email` ON `users` (`email`)",
+      "ALTER TABLE `users` ADD CONSTRAINT `users_ibfk_1` FOREIGN KEY (`org_id`) REFERENCES `orgs` (`id`) ON UPDATE NO ACTION ON DELETE CASCADE",
+    }},
+  }
+
+  for _, test := range tests {
+    a, err := readSource(test.dialect + ":" + src)
+    if err != nil {
+      t.Fatal(err)
+    }
+    b, err := readSource(test.dialect + ":" + dst)
+    if err != nil {
+      t.Fatal(err)
+    }
+    diffs := diffSchemas(a.Structs, b.Structs)
+
+    var text strings.Builder
+    writeDiff(&text, diffs)
+    if text.String() != test.text {
+      t.Errorf("%s: expected:\n%s\ngot:\n%s", test.dialect, test.text, text.String())
+    }
+    if sql := a.alterSQL(diffs); !reflect.DeepEqual(sql, test.sql) {
+      t.Errorf("%s: expected:\n%s\ngot:\n%s", test.dialect, strings.Join(test.sql, ";\n"), strings.Join(sql, ";\n"))
+    }
+
+    if diffs := diffSchemas(a.Structs, a.Structs); len(diffs) != 0 {
+      t.Errorf("%s: expected no differences with itself, got %+v", test.dialect, diffs)
+    }
+  }
+
+  if _, err := readSource("oracle:" + src); err == nil {
+    t.Error("expected an error for an unknown db")
+  }
+
+  // 1 when the schemas differ and 2 on errors
+  for expect, args := range map[int][]string{
+    0: {"postgresql:" + src, "postgresql:" + src},
+    1: {"postgresql:" + src, "postgresql:" + dst},
+    2: {"postgresql:" + src, dir + "/missing.json"},
+  } {
+    if code := diffCommand(args); code != expect {
+      t.Errorf("%q: expected exit code %d, got %d", args, expect, code)
+    }
+  }
+  if code := diffCommand([]string{"postgresql:" + src}); code != 2 {
+    t.Errorf("expected exit code 2 without dst, got %d", code)
+  }
+
+  // a live database
+  var md *Metadata
+  var err error
+  stmts := withFakePostgresql(func() {
+    md, err = readSource("postgresql:host=localhost dbname=shop")
+  })
+  if err != nil || md.Dialect != "postgresql" || len(stmts) == 0 || !strings.Contains(stmts[0], "obj_description") {
+    t.Errorf("expected postgresql to be introspected, got %v, %q", err, stmts)
+  }
+}
+
+func TestMigrateCommand(t *testing.T) {
+  dir := t.TempDir()
+  migrations, dsn := dir+"/migrations", dir+"/test.db"
+
+  if code := migrateCommand([]string{"new", "-dir", migrations, "create users"}); code != 0 {
+    t.Fatalf("new: exit code %d", code)
+  }
+  ups, _ := filepath.Glob(migrations + "/*_create_users.up.sql")
+  if len(ups) != 1 {
+    t.Fatalf("expected one up migration, got %v", ups)
+  }
+  os.WriteFile(ups[0], []byte("create table users (id integer primary key);"), 0644)
+
+  if code := migrateCommand([]string{"-dir", migrations, "up", "sqlite3", dsn}); code != 0 {
+    t.Fatalf("up: exit code %d", code)
+  }
+  md := &Metadata{Dialect: "sqlite3"}
+  err := introspect(md, dsn)
+  if err != nil {
+    t.Fatal(err)
+  }
+  var names []string
+  for _, strct := range md.Structs {
+    names = append(names, strct.Name)
+  }
+  if !reflect.DeepEqual(names, []string{"schema_migrations", "users"}) {
+    t.Errorf("expected schema_migrations and users, got %v", names)
+  }
+
+  if code := migrateCommand([]string{"status", "-dir", migrations, "sqlite3", dsn}); code != 0 {
+    t.Errorf("status: exit code %d", code)
+  }
+  if code := migrateCommand([]string{"up"}); code != 1 {
+    t.Errorf("expected exit code 1 without a db, got %d", code)
+  }
+
+  // postgresql is opened with its driver and migrated under its lock
+  stmts := withFakePostgresql(func() {
+    if code := migrateCommand([]string{"-dir", migrations, "up", "postgresql", "host=localhost"}); code != 0 {
+      t.Errorf("up postgresql: exit code %d", code)
+    }
+  })
+  if len(stmts) == 0 || stmts[0] != "SELECT pg_advisory_lock($1)" || stmts[len(stmts)-1] != "SELECT pg_advisory_unlock($1)" {
+    t.Errorf("expected the postgresql lock, got %q", stmts)
+  }
+}
+
+// fakeDriver is a database/sql driver recording the statements run on
+// it, whose queries return no rows, to test what runs on a db without
+// one
+type fakeDriver struct {
+  mu    sync.Mutex
+  stmts []string
+}
+
+func (d *fakeDriver) record(query string) {
+  d.mu.Lock()
+  defer d.mu.Unlock()
+  d.stmts = append(d.stmts, query)
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) { return fakeConn{d}, nil }
+
+type fakeConn struct{ d *fakeDriver }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{c.d, query}, nil }
+func (c fakeConn) Close() error                              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error) {
+  c.d.record("BEGIN")
+  return fakeTx{c.d}, nil
+}
+
+type fakeTx struct{ d *fakeDriver }
+
+func (tx fakeTx) Commit() error   { tx.d.record("COMMIT"); return nil }
+func (tx fakeTx) Rollback() error { tx.d.record("ROLLBACK"); return nil }
+
+type fakeStmt struct {
+  d     *fakeDriver
+  query string
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+  s.d.record(s.query)
+  return driver.RowsAffected(0), nil
+}
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+  s.d.record(s.query)
+  return fakeRows{}, nil
+}
+
+type fakeRows struct{}
+
+func (fakeRows) Columns() []string              { return nil }
+func (fakeRows) Close() error                   { return nil }
+func (fakeRows) Next(dest []driver.Value) error { return io.EOF }
+
+var fakePostgresql = &fakeDriver{}
+
+func init() {
+  sql.Register("kdbtest-postgresql", fakePostgresql)
+}
+
+// run fn with postgresql opened as the fake driver, returning the
+// statements it ran
+func withFakePostgresql(fn func()) []string {
+  driverNames["postgresql"] = "kdbtest-postgresql"
+  defer func() { driverNames["postgresql"] = "postgres" }()
+
+  fakePostgresql.mu.Lock()
+  fakePostgresql.stmts = nil
+  fakePostgresql.mu.Unlock()
+  fn()
+  return fakePostgresql.stmts
+}
+
+func TestIntrospectDriver(t *testing.T) {
+  // pq registers itself as postgres
+  if driverName("postgresql") != "postgres" || driverName("mysql") != "mysql" || driverName("sqlite3") != "sqlite3" {
+    t.Fatal("unexpected driver names")
+  }
+  db, err := sql.Open(driverName("postgresql"), "host=localhost")
+  if err != nil {
+    t.Fatal(err)
+  }
+  db.Close()
+
+  stmts := withFakePostgresql(func() {
+    err = introspect(&Metadata{Dialect: "postgresql"}, "host=localhost")
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(stmts) == 0 || !strings.Contains(stmts[0], "obj_description") {
+    t.Errorf("expected the postgresql queries, got %q", stmts)
+  }
 }
@@ -5,18 +5,115 @@ import (
   "io"
   "reflect"
   "strings"
+  "time"
 )
 
+var timeType = reflect.TypeOf(time.Time{})
+
+// The model is written by -dump-schema and read by -from-schema as
+// JSON; the names formatted for the code (CleanName) and what -config
+// sets (GoType) are left out, as they belong to generating. Field's
+// Type is written by name, see dumpTypes.
 type Field struct {
-  Name      string
-  CleanName string
-  Type      reflect.Type
+  Name      string       `json:"name"`
+  CleanName string       `json:"-"`
+  Type      reflect.Type `json:"-"`
+  Nullable  bool         `json:"nullable,omitempty"`
+
+  // as much of the following as the database reports
+  SQLType       string   `json:"sql_type"` // the column type as declared, e.g. "int(10) unsigned"
+  Unsigned      bool     `json:"unsigned,omitempty"`
+  Default       *string  `json:"default,omitempty"` // nil when the column has no default
+  Comment       string   `json:"comment,omitempty"`
+  PrimaryKey    bool     `json:"primary_key,omitempty"`
+  AutoIncrement bool     `json:"auto_increment,omitempty"`
+  Values        []string `json:"values,omitempty"` // the values of enum and set columns
+  Length        int64    `json:"length,omitempty"` // the maximum length of character columns
+
+  GoType string `json:"-"` // overrides Type when set, see Config.TypeMap
+}
+
+type Index struct {
+  Name    string   `json:"name"`
+  Columns []string `json:"columns"` // in index order; empty for expressions
+  Unique  bool     `json:"unique,omitempty"`
+  Primary bool     `json:"primary,omitempty"`
+}
+
+type ForeignKey struct {
+  Name       string   `json:"name"`
+  Columns    []string `json:"columns"`
+  RefSchema  string   `json:"ref_schema,omitempty"` // set like Struct.Schema
+  RefTable   string   `json:"ref_table"`
+  RefColumns []string `json:"ref_columns"`
+  OnUpdate   string   `json:"on_update"`
+  OnDelete   string   `json:"on_delete"`
 }
 
 type Struct struct {
-  Name      string
-  CleanName string
-  Fields    []Field
+  Name         string       `json:"name"`
+  Schema       string       `json:"schema,omitempty"` // only set with -schema
+  CleanName    string       `json:"-"`
+  Comment      string       `json:"comment,omitempty"`
+  View         bool         `json:"view,omitempty"`
+  Materialized bool         `json:"materialized,omitempty"` // a materialized view; View is set too
+  Fields       []Field      `json:"columns"`
+  PrimaryKey   []string     `json:"primary_key,omitempty"` // the primary key column names, in key order
+  Indexes      []Index      `json:"indexes,omitempty"`
+  ForeignKeys  []ForeignKey `json:"foreign_keys,omitempty"`
+}
+
+// mark the field named name as (part of) the primary key
+func (s *Struct) setPrimaryKey(name string) {
+  for i := range s.Fields {
+    if s.Fields[i].Name == name {
+      s.Fields[i].PrimaryKey = true
+    }
+  }
+  s.PrimaryKey = append(s.PrimaryKey, name)
+}
+
+// add a column (empty for an expression) to the index named name,
+// creating the index if needed
+func (s *Struct) addIndexColumn(name string, unique, primary bool, column string) {
+  for i := range s.Indexes {
+    if s.Indexes[i].Name == name {
+      s.Indexes[i].Columns = append(s.Indexes[i].Columns, column)
+      return
+    }
+  }
+  s.Indexes = append(s.Indexes, Index{
+    Name:    name,
+    Columns: []string{column},
+    Unique:  unique,
+    Primary: primary,
+  })
+}
+
+// add a column pair to the foreign key named name, creating the
+// foreign key if needed
+func (s *Struct) addForeignKeyColumn(name, column, refSchema, refTable, refColumn, onUpdate, onDelete string) {
+  for i := range s.ForeignKeys {
+    if s.ForeignKeys[i].Name == name {
+      s.ForeignKeys[i].Columns = append(s.ForeignKeys[i].Columns, column)
+      s.ForeignKeys[i].RefColumns = append(s.ForeignKeys[i].RefColumns, refColumn)
+      return
+    }
+  }
+  s.ForeignKeys = append(s.ForeignKeys, ForeignKey{
+    Name:       name,
+    Columns:    []string{column},
+    RefSchema:  refSchema,
+    RefTable:   refTable,
+    RefColumns: []string{refColumn},
+    OnUpdate:   onUpdate,
+    OnDelete:   onDelete,
+  })
+}
+
+// makes a comment safe to output on a single line
+func oneLine(s string) string {
+  return strings.Join(strings.Fields(s), " ")
 }
 
 type Code []string
@@ -29,93 +126,183 @@ func (c *Code) Appendf(format string, args ...interface{}) {
   *c = append(*c, fmt.Sprintf(format, args...))
 }
 
+func (c Code) String() string {
+  return strings.Join(c, "")
+}
+
 type Metadata struct {
   Args    []string
   Package string
+  Dialect string // mysql, postgresql or sqlite3
   Structs []Struct
 
   // filled by Create()
-  ImportCode  Code
-  InsertStmts Code
-  SelectStmts Code
-  StructCode  Code
+  Imports      map[string]bool
+  CrudCode     Code
+  FinderCode   Code
+  RelationCode Code
 }
 
-func (md *Metadata) Create() *Metadata {
-  if *types == "null" {
-    md.ImportCode.Append("import \"database/sql\"\n")
+// quote an identifier for the dialect
+func (md *Metadata) quote(name string) string {
+  if md.Dialect == "mysql" {
+    return "`" + strings.Replace(name, "`", "``", -1) + "`"
   }
+  return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
 
-  for _, strct := range md.Structs {
-    var args []string
-    var sqlArgs []string
+// return the n'th (1 based) placeholder for the dialect
+func (md *Metadata) placeholder(n int) string {
+  if md.Dialect == "postgresql" {
+    return fmt.Sprintf("$%d", n)
+  }
+  return "?"
+}
 
-    // Output the table struct
-    md.StructCode.Appendf("type %s struct {", strct.CleanName)
-    for _, field := range strct.Fields {
-      tag := ""
-      if *sqlstruct {
-        tag = "`sql:\"" + field.Name + "\"`"
-      }
-
-      typ := field.Type.String()
-      if !strings.HasPrefix(typ, "[]") {
-        switch *types {
-        case "null":
-          typ = "sql.Null" + capitalize(typ)
-        case "pointer":
-          typ = "*" + typ
-        }
-      }
-
-      md.StructCode.Appendf("%s %s%s;", field.CleanName, typ, tag)
-
-      sqlArgs = append(sqlArgs, field.CleanName)
-      args = append(args, "&t."+field.CleanName)
-    }
-    md.StructCode.Appendf("};")
+// the sql.Null* type for each base type, if there is one
+var sqlNullTypes = map[string]string{
+  "string":    "sql.NullString",
+  "int64":     "sql.NullInt64",
+  "int32":     "sql.NullInt32",
+  "int16":     "sql.NullInt16",
+  "uint8":     "sql.NullByte",
+  "float64":   "sql.NullFloat64",
+  "bool":      "sql.NullBool",
+  "time.Time": "sql.NullTime",
+}
+
+// return the nullable version of time.Time according to the -nulltime
+// flag, which defaults to following -nulltype.
+func (md *Metadata) nullTime() string {
+  style := *nullTime
+  if style == "" {
+    style = *nullType
+  }
+
+  switch style {
+  case "pointer":
+    return "*time.Time"
+  case "kdb":
+    md.Imports["github.com/kdar/kdb"] = true
+    return "kdb.NullTime"
+  }
 
-    // Args function
-    md.StructCode.Appendf("func (t *%s) Args() []interface{} {return []interface{}{%s}};", strct.CleanName, strings.Join(args, ","))
+  md.Imports["database/sql"] = true
+  return "sql.NullTime"
+}
 
-    // Insert statements
-    insertValues := strings.Repeat("?, ", len(sqlArgs))
-    md.InsertStmts.Appendf(
-      `"INSERT INTO %s (%s) VALUES (%s)"`,
-      strct.CleanName,
-      strings.Join(sqlArgs, ","),
-      insertValues[:len(insertValues)-2])
+// return the nullable version of typ according to the -nulltype flag,
+// noting any packages it needs.
+func (md *Metadata) nullType(typ string) string {
+  if typ == "time.Time" {
+    return md.nullTime()
+  }
 
-    // Select statements
-    md.SelectStmts.Appendf(
-      `"SELECT %s FROM %s"`,
-      strings.Join(sqlArgs, ","),
-      strct.CleanName)
+  switch *nullType {
+  case "pointer":
+    return "*" + typ
+  case "kdb":
+    md.Imports["github.com/kdar/kdb"] = true
+    return "kdb.Null[" + typ + "]"
   }
 
-  return md
+  md.Imports["database/sql"] = true
+  if t, ok := sqlNullTypes[typ]; ok {
+    return t
+  }
+  return "sql.Null[" + typ + "]"
 }
 
-func (md *Metadata) Output(w io.Writer) {
-  fmt.Fprint(w, "// GENERATED BY dbtogo (github.com/kdar/dbtogo); DO NOT EDIT\n")
-  fmt.Fprintf(w, "// ---args: %s\n", strings.Join(md.Args, " "))
-  fmt.Fprintf(w, "package %s\n", md.Package)
+// return the Go type of the field according to the -types flag.
+func (md *Metadata) goType(field Field) string {
+  if field.GoType != "" {
+    return md.importType(field.GoType)
+  }
+
+  typ := md.fieldType(field)
+  if strings.Contains(typ, "time.Time") {
+    md.Imports["time"] = true
+  }
+  return typ
+}
+
+// note the package of a type written with its import path, e.g.
+// "*github.com/shopspring/decimal.Decimal", and return the type as
+// used in code, e.g. "*decimal.Decimal".
+func (md *Metadata) importType(typ string) string {
+  prefix := typ[:len(typ)-len(strings.TrimLeft(typ, "*[]"))]
+  name := typ[len(prefix):]
+
+  head := name
+  if i := strings.Index(head, "["); i >= 0 {
+    head = head[:i]
+  }
+  i := strings.LastIndex(head, ".")
+  if i < 0 {
+    return typ
+  }
+
+  pkg := head[:i]
+  md.Imports[pkg] = true
+  return prefix + pkg[strings.LastIndex(pkg, "/")+1:] + name[i:]
+}
+
+func (md *Metadata) fieldType(field Field) string {
+  typ := field.Type.String()
+
+  // a nil slice already represents NULL
+  if strings.HasPrefix(typ, "[]") {
+    return typ
+  }
 
-  fmt.Fprint(w, strings.Join(md.ImportCode, ""))
+  switch *types {
+  case "null":
+    return md.nullType(typ)
+  case "pointer":
+    return "*" + typ
+  case "auto":
+    if field.Nullable {
+      return md.nullType(typ)
+    }
+  }
 
-  fmt.Fprintf(w, "type Arger interface {Args() []interface{}};")
+  return typ
+}
 
-  fmt.Fprint(w, "var InsertStmts = map[string]string{\n")
-  for n, i := range md.InsertStmts {
-    fmt.Fprintf(w, "\"%s\": %s,\n", md.Structs[n].CleanName, i)
+func (md *Metadata) Create() *Metadata {
+  md.Imports = make(map[string]bool)
+  md.CrudCode, md.FinderCode, md.RelationCode = nil, nil, nil
+
+  for _, strct := range md.Structs {
+    // note the imports the field types need
+    for _, field := range strct.Fields {
+      md.goType(field)
+    }
+
+    if *crud {
+      md.createCrud(strct)
+    }
+    if *findersFlag {
+      md.createFinders(strct)
+    }
+    if *relations {
+      md.createRelations(strct)
+    }
   }
-  fmt.Fprint(w, "}\n")
 
-  fmt.Fprint(w, "var SelectStmts = map[string]string{\n")
-  for n, i := range md.SelectStmts {
-    fmt.Fprintf(w, "\"%s\": %s,\n", md.Structs[n].CleanName, i)
+  if *verify {
+    md.Imports["context"] = true
+    md.Imports["github.com/kdar/kdb"] = true
   }
-  fmt.Fprint(w, "}\n")
 
-  fmt.Fprint(w, strings.Join(md.StructCode, ""))
+  return md
+}
+
+// execute the -template, or the default template, with md
+func (md *Metadata) Output(w io.Writer) error {
+  t, err := md.template(*templatePath)
+  if err != nil {
+    return err
+  }
+  return t.Execute(w, md)
 }
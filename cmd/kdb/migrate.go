@@ -0,0 +1,163 @@
+package main
+
+import (
+  "context"
+  "database/sql"
+  goflag "flag"
+  "fmt"
+  "github.com/kdar/kdb/migrate"
+  "os"
+  "strings"
+  "text/tabwriter"
+)
+
+const migrateHelpMsg = `kdb migrate applies the SQL migrations of a directory to a database,
+see the github.com/kdar/kdb/migrate package for their files.
+
+Usage:
+
+\tkdb migrate [OPTIONS] up [<db> <db connect string>]
+\tkdb migrate [OPTIONS] down [<db> <db connect string>]
+\tkdb migrate [OPTIONS] status [<db> <db connect string>]
+\tkdb migrate [OPTIONS] new <name>
+
+Commands:
+
+\tup                 \tapply the migrations not applied yet
+\tdown               \troll back the latest -n migrations
+\tstatus             \tlist the migrations and whether they are applied
+\tnew                \tcreate the up and down files of a migration
+
+Options:
+
+\t-dir <directory>   \tthe migrations, "migrations" by default
+\t-table <name>      \tthe table applied migrations are recorded in,
+\t                   \t"schema_migrations" by default
+\t-n <count>         \tthe number of migrations down rolls back, 1 by
+\t                   \tdefault
+\t-config <file>     \ta kdb config file to read the db, connect string
+\t                   \tand directory (migrations) from
+
+Go migrations are registered with the package in the program that
+runs them, so kdb migrate lists them as missing once applied.
+`
+
+// run kdb migrate with its arguments, returning the exit code
+func migrateCommand(args []string) int {
+  flags := goflag.NewFlagSet("kdb migrate", goflag.ExitOnError)
+  dir := flags.String("dir", "", "")
+  table := flags.String("table", "schema_migrations", "")
+  n := flags.Int("n", 1, "")
+  cfgPath := flags.String("config", "", "")
+  flags.Usage = func() {
+    fmt.Fprint(os.Stderr, strings.Replace(migrateHelpMsg, "\\t", "\t", -1))
+  }
+
+  // the options may come before or after the command
+  flags.Parse(args)
+  if flags.NArg() == 0 {
+    flags.Usage()
+    return 1
+  }
+  command := flags.Arg(0)
+  flags.Parse(flags.Args()[1:])
+
+  var cfg Config
+  if *cfgPath != "" {
+    var err error
+    cfg, err = loadConfig(*cfgPath)
+    if err != nil {
+      fatal(err)
+    }
+  }
+  if *dir == "" {
+    *dir = cfg.Migrations
+  }
+  if *dir == "" {
+    *dir = "migrations"
+  }
+
+  if command == "new" {
+    if flags.NArg() != 1 {
+      flags.Usage()
+      return 1
+    }
+    up, down, err := migrate.CreateFiles(*dir, flags.Arg(0))
+    if err != nil {
+      fatal(err)
+    }
+    fmt.Println(up)
+    fmt.Println(down)
+    return 0
+  }
+
+  dialect, dsn := cfg.Driver, cfg.DSN
+  switch {
+  case flags.NArg() == 2:
+    dialect, dsn = flags.Arg(0), flags.Arg(1)
+  case flags.NArg() != 0:
+    dialect = ""
+  }
+  if dialect == "" || dsn == "" {
+    flags.Usage()
+    return 1
+  }
+
+  db, err := sql.Open(driverName(dialect), dsn)
+  if err != nil {
+    fatal(err)
+  }
+  defer db.Close()
+
+  m := migrate.New(db, dialect)
+  m.Table = *table
+  err = m.Load(os.DirFS(*dir), ".")
+  if err != nil {
+    fatal(err)
+  }
+
+  ctx := context.Background()
+  switch command {
+  case "up":
+    applied, err := m.Up(ctx)
+    for _, mig := range applied {
+      fmt.Println("applied", mig)
+    }
+    if err != nil {
+      fatal(err)
+    }
+  case "down":
+    rolledBack, err := m.Down(ctx, *n)
+    for _, mig := range rolledBack {
+      fmt.Println("rolled back", mig)
+    }
+    if err != nil {
+      fatal(err)
+    }
+  case "status":
+    statuses, err := m.Status(ctx)
+    if err != nil {
+      fatal(err)
+    }
+    w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+    fmt.Fprintln(w, "VERSION\tNAME\tSTATUS")
+    for _, s := range statuses {
+      status := "pending"
+      if s.Applied {
+        status = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+      }
+      switch {
+      case s.Changed:
+        status += ", changed since"
+      case s.Missing:
+        status += ", missing"
+      }
+      fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, status)
+    }
+    w.Flush()
+  default:
+    flags.Usage()
+    return 1
+  }
+  return 0
+}
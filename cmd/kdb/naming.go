@@ -0,0 +1,250 @@
+package main
+
+import (
+  "go/token"
+  "strings"
+  "unicode"
+  "unicode/utf8"
+)
+
+// the initialisms kept upper case by the initialisms format, unless
+// -initialisms gives others
+var defaultInitialisms = []string{
+  "ACL", "API", "ASCII", "CPU", "CSS", "DNS", "EOF", "GUID", "HTML",
+  "HTTP", "HTTPS", "ID", "IP", "JSON", "LHS", "QPS", "RAM", "RHS",
+  "RPC", "SLA", "SMTP", "SQL", "SSH", "TCP", "TLS", "TTL", "UDP",
+  "UI", "UID", "UUID", "URI", "URL", "UTF8", "VM", "XML", "XMPP",
+  "XSRF", "XSS",
+}
+
+// words that do not follow the singular rules
+var irregularPlurals = map[string]string{
+  "people":   "person",
+  "children": "child",
+  "men":      "man",
+  "women":    "woman",
+  "mice":     "mouse",
+  "geese":    "goose",
+  "feet":     "foot",
+  "teeth":    "tooth",
+  "data":     "datum",
+  "indices":  "index",
+  "matrices": "matrix",
+  "vertices": "vertex",
+  "criteria": "criterion",
+  "statuses": "status",
+  "aliases":  "alias",
+  "movies":   "movie",
+  "cookies":  "cookie",
+  "caches":   "cache",
+}
+
+// words that are the same singular and plural, or only look plural
+var uncountables = map[string]bool{
+  "series":      true,
+  "species":     true,
+  "news":        true,
+  "status":      true,
+  "analysis":    true,
+  "information": true,
+  "equipment":   true,
+  "sheep":       true,
+  "fish":        true,
+  "metadata":    true,
+}
+
+// split s into its words at upper case letters following lower case
+// ones or digits, and at the last of a run of upper case letters
+// followed by a lower case one, e.g. "HTTPServerID2" is "HTTP",
+// "Server", "ID2".
+func splitWords(s string) []string {
+  runes := []rune(s)
+
+  var words []string
+  start := 0
+  for i := 1; i < len(runes); i++ {
+    prev, r := runes[i-1], runes[i]
+    next := rune(0)
+    if i+1 < len(runes) {
+      next = runes[i+1]
+    }
+
+    if unicode.IsUpper(r) && (unicode.IsLower(prev) || unicode.IsDigit(prev)) ||
+      unicode.IsUpper(prev) && unicode.IsUpper(r) && unicode.IsLower(next) {
+      words = append(words, string(runes[start:i]))
+      start = i
+    }
+  }
+  if start < len(runes) {
+    words = append(words, string(runes[start:]))
+  }
+
+  return words
+}
+
+// apply f to the words of each underscore separated part of s
+func mapWords(s string, f func(word string) string) string {
+  parts := strings.Split(s, "_")
+  for i, part := range parts {
+    words := splitWords(part)
+    for j, word := range words {
+      words[j] = f(word)
+    }
+    parts[i] = strings.Join(words, "")
+  }
+  return strings.Join(parts, "_")
+}
+
+// capitalize each underscore separated part of the string and remove
+// the underscores, e.g. "user_id" is "UserId"
+func camel(s string) string {
+  parts := strings.Split(s, "_")
+  for i, part := range parts {
+    parts[i] = capitalize(part)
+  }
+  return strings.Join(parts, "")
+}
+
+// upper case the words of the string that are initialisms, e.g.
+// "user_id" is "user_ID" and "UserUrl" is "UserURL"
+func initialisms(s string) string {
+  list := defaultInitialisms
+  if *initialismsFlag != "" {
+    list = strings.Split(*initialismsFlag, ",")
+  }
+
+  known := make(map[string]bool)
+  for _, initialism := range list {
+    known[strings.ToUpper(strings.TrimSpace(initialism))] = true
+  }
+
+  return mapWords(s, func(word string) string {
+    if known[strings.ToUpper(word)] {
+      return strings.ToUpper(word)
+    }
+    return word
+  })
+}
+
+// return the singular of an English word, keeping its case
+func singularWord(word string) string {
+  lower := strings.ToLower(word)
+
+  var ret string
+  switch {
+  case uncountables[lower]:
+    return word
+  case irregularPlurals[lower] != "":
+    ret = irregularPlurals[lower]
+  case strings.HasSuffix(lower, "ies") && len(lower) > 4:
+    ret = lower[:len(lower)-3] + "y"
+  case strings.HasSuffix(lower, "sses"), strings.HasSuffix(lower, "shes"),
+    strings.HasSuffix(lower, "ches"), strings.HasSuffix(lower, "xes"),
+    strings.HasSuffix(lower, "zzes"):
+    ret = lower[:len(lower)-2]
+  case strings.HasSuffix(lower, "s") && !strings.HasSuffix(lower, "ss") &&
+    !strings.HasSuffix(lower, "us") && !strings.HasSuffix(lower, "is") && len(lower) > 1:
+    ret = lower[:len(lower)-1]
+  default:
+    return word
+  }
+
+  switch {
+  case word == strings.ToUpper(word):
+    return strings.ToUpper(ret)
+  case word != lower:
+    r, _ := utf8.DecodeRuneInString(word)
+    if unicode.IsUpper(r) {
+      return capitalize(ret)
+    }
+  }
+  return ret
+}
+
+// make the last word of the string singular, e.g. "order_items" is
+// "order_item" and "UserAddresses" is "UserAddress"
+func singular(s string) string {
+  i := strings.LastIndex(s, "_")
+  words := splitWords(s[i+1:])
+  if len(words) == 0 {
+    return s
+  }
+  words[len(words)-1] = singularWord(words[len(words)-1])
+  return s[:i+1] + strings.Join(words, "")
+}
+
+// return the plural of an English word, keeping its case. Words that
+// already are plural are returned as is.
+func pluralWord(word string) string {
+  lower := strings.ToLower(word)
+  if uncountables[lower] || singularWord(word) != word {
+    return word
+  }
+
+  ret := ""
+  for plural, singular := range irregularPlurals {
+    if singular == lower {
+      ret = plural
+    }
+  }
+  switch {
+  case ret != "":
+  case strings.HasSuffix(lower, "y") && len(lower) > 1 && !strings.ContainsRune("aeiou", rune(lower[len(lower)-2])):
+    ret = lower[:len(lower)-1] + "ies"
+  case strings.HasSuffix(lower, "s"), strings.HasSuffix(lower, "x"), strings.HasSuffix(lower, "z"),
+    strings.HasSuffix(lower, "ch"), strings.HasSuffix(lower, "sh"):
+    ret = lower + "es"
+  default:
+    ret = lower + "s"
+  }
+
+  switch {
+  case word == strings.ToUpper(word):
+    return strings.ToUpper(ret)
+  case word != lower:
+    r, _ := utf8.DecodeRuneInString(word)
+    if unicode.IsUpper(r) {
+      return capitalize(ret)
+    }
+  }
+  return ret
+}
+
+// make the last word of the string plural, e.g. "order_item" is
+// "order_items" and "UserAddress" is "UserAddresses"
+func plural(s string) string {
+  i := strings.LastIndex(s, "_")
+  words := splitWords(s[i+1:])
+  if len(words) == 0 {
+    return s
+  }
+  words[len(words)-1] = pluralWord(words[len(words)-1])
+  return s[:i+1] + strings.Join(words, "")
+}
+
+// replace the characters that can not be part of an identifier, such
+// as spaces, dashes and dots, with underscores
+func identifierChars(s string) string {
+  return strings.Map(func(r rune) rune {
+    if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+      return r
+    }
+    return '_'
+  }, s)
+}
+
+// make a formatted name a valid identifier: prefix names that do not
+// start with a letter or an underscore with X, and suffix keywords
+// with an underscore
+func identifier(s string) string {
+  if s == "" {
+    return "X"
+  }
+  if r, _ := utf8.DecodeRuneInString(s); !unicode.IsLetter(r) && r != '_' {
+    s = "X" + s
+  }
+  if token.IsKeyword(s) {
+    s += "_"
+  }
+  return s
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+  "fmt"
+  "strings"
+)
+
+// return the struct for a table, if it is being generated
+func (md *Metadata) findStruct(schema, table string) (Struct, bool) {
+  for _, strct := range md.Structs {
+    if strct.Schema == schema && strct.Name == table {
+      return strct, true
+    }
+  }
+  return Struct{}, false
+}
+
+// return the fields of strct named by columns, or false if any of
+// them is missing
+func fieldsNamed(strct Struct, columns []string) ([]Field, bool) {
+  var fields []Field
+  for _, col := range columns {
+    found := false
+    for _, f := range strct.Fields {
+      if f.Name == col {
+        fields = append(fields, f)
+        found = true
+      }
+    }
+    if !found {
+      return nil, false
+    }
+  }
+  return fields, true
+}
+
+// return a comment naming what the field references, if it is part
+// of a foreign key
+func references(strct Struct, field Field) string {
+  for _, fk := range strct.ForeignKeys {
+    for i, col := range fk.Columns {
+      if col != field.Name || i >= len(fk.RefColumns) {
+        continue
+      }
+      if fk.RefSchema != "" {
+        return fmt.Sprintf("references %s.%s.%s", fk.RefSchema, fk.RefTable, fk.RefColumns[i])
+      }
+      return fmt.Sprintf("references %s.%s", fk.RefTable, fk.RefColumns[i])
+    }
+  }
+  return ""
+}
+
+// return the clean names of fields joined together
+func joinCleanNames(fields []Field) string {
+  var names []string
+  for _, f := range fields {
+    names = append(names, f.CleanName)
+  }
+  return strings.Join(names, "And")
+}
+
+// a method following a foreign key
+type relation struct {
+  method string
+  many   bool    // whether it returns the referencing rows
+  target Struct  // the struct it returns
+  where  []Field // the fields of target it looks up
+  args   []Field // the fields of the receiver it looks them up by
+}
+
+// return the relations of strct: one for each of its foreign keys
+// returning the referenced row, and one for each foreign key
+// referencing strct returning the referencing rows. The methods are
+// named after the struct they return, singular for the referenced row
+// and plural for the referencing rows; when a table is referenced more
+// than once they are told apart by the foreign key columns, and a
+// method that would still clash with a field or another method gets a
+// number suffix. Those clashes are returned too.
+func (md *Metadata) relations(strct Struct) ([]relation, []string) {
+  if strct.View {
+    return nil, nil
+  }
+
+  // how often each struct would be returned
+  count := make(map[string]int)
+  for _, fk := range strct.ForeignKeys {
+    if ref, ok := md.findStruct(fk.RefSchema, fk.RefTable); ok {
+      count[ref.CleanName]++
+    }
+  }
+  for _, child := range md.Structs {
+    for _, fk := range child.ForeignKeys {
+      if fk.RefSchema == strct.Schema && fk.RefTable == strct.Name && !child.View {
+        count[child.CleanName]++
+      }
+    }
+  }
+
+  var rels []relation
+
+  // the referenced rows
+  for _, fk := range strct.ForeignKeys {
+    ref, ok := md.findStruct(fk.RefSchema, fk.RefTable)
+    if !ok {
+      continue
+    }
+    cols, ok := fieldsNamed(strct, fk.Columns)
+    if !ok {
+      continue
+    }
+    refCols, ok := fieldsNamed(ref, fk.RefColumns)
+    if !ok || len(refCols) != len(cols) {
+      continue
+    }
+
+    method := singular(ref.CleanName)
+    if count[ref.CleanName] > 1 {
+      method = joinCleanNames(cols) + method
+    }
+    rels = append(rels, relation{method: method, target: ref, where: refCols, args: cols})
+  }
+
+  // the referencing rows
+  for _, child := range md.Structs {
+    if child.View {
+      continue
+    }
+
+    for _, fk := range child.ForeignKeys {
+      if fk.RefSchema != strct.Schema || fk.RefTable != strct.Name {
+        continue
+      }
+      cols, ok := fieldsNamed(child, fk.Columns)
+      if !ok {
+        continue
+      }
+      refCols, ok := fieldsNamed(strct, fk.RefColumns)
+      if !ok || len(refCols) != len(cols) {
+        continue
+      }
+
+      method := plural(child.CleanName)
+      if count[child.CleanName] > 1 {
+        method += "By" + joinCleanNames(cols)
+      }
+      rels = append(rels, relation{method: method, many: true, target: child, where: cols, args: refCols})
+    }
+  }
+
+  used := map[string]string{"Args": "the Args method"}
+  for _, f := range strct.Fields {
+    used[f.CleanName] = "the field of column " + f.Name
+  }
+
+  var clashes []string
+  for i, rel := range rels {
+    method := rel.method
+    for n := 2; used[method] != ""; n++ {
+      method = fmt.Sprintf("%s%d", rel.method, n)
+    }
+    if method != rel.method {
+      clashes = append(clashes, fmt.Sprintf("table %s: the relation method %s to %s clashes with %s; it is %s",
+        strct.Name, rel.method, rel.target.Name, used[rel.method], method))
+      rels[i].method = method
+    }
+    used[method] = "the relation method to " + rel.target.Name
+  }
+
+  return rels, clashes
+}
+
+// create the relation methods of strct
+func (md *Metadata) createRelations(strct Struct) {
+  rels, _ := md.relations(strct)
+  recv := "(t *" + strct.CleanName + ") "
+
+  for _, rel := range rels {
+    var args []string
+    for _, f := range rel.args {
+      args = append(args, ", t."+f.CleanName)
+    }
+    query := md.selectSQL(rel.target) + " WHERE " + md.assignments(rel.where, " AND ", 1)
+
+    md.Imports["context"] = true
+    md.Imports["database/sql"] = true
+    if rel.many {
+      md.RelationCode.listFunc(
+        fmt.Sprintf("%s returns the rows of %s referencing t.", rel.method, rel.target.Name),
+        recv+rel.method, rel.target.CleanName, query, nil, args)
+    } else {
+      md.RelationCode.getFunc(
+        fmt.Sprintf("%s returns the row of %s referenced by t.%s.", rel.method, rel.target.Name, joinCleanNames(rel.args)),
+        recv+rel.method, rel.target.CleanName, query, nil, args)
+    }
+  }
+}
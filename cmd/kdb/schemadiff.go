@@ -0,0 +1,700 @@
+package main
+
+import (
+  "encoding/json"
+  goflag "flag"
+  "fmt"
+  "io"
+  "os"
+  "sort"
+  "strings"
+)
+
+const diffHelpMsg = `kdb diff compares the tables of two schemas and reports what dst has
+that src does not, what src has that dst does not, and what differs.
+
+Usage:
+
+\tkdb diff [OPTIONS] <src> <dst>
+
+Sources:
+
+\t<file>.json            \ta -dump-schema file
+\t<db>:<file or directory>\tDDL files, read as -ddl reads them
+\t<db>:<connect string>  \ta database, e.g. "sqlite3:./foo.db"
+
+Options:
+
+\t-json              \toutput the differences as JSON
+\t-sql               \toutput the statements changing src into dst, in
+\t                   \tthe dialect of src, instead of the differences.
+\t                   \tWhat a dialect can not alter (e.g. sqlite3
+\t                   \tcolumns) is left as a comment
+\t-tables, -exclude, -views, -matviews, -schema
+\t                   \tselect the tables compared, as for kdb
+
+Tables and views are matched by name (and schema), columns and indexes
+by name and foreign keys by their columns. Columns differ in their SQL
+type, nullability, default or auto increment. kdb diff exits with 1
+when the schemas differ and with 2 on errors, as diff does.
+`
+
+// a difference of a column, index, foreign key or primary key:
+// added (To only), removed (From only) or changed
+type objectDiff[T any] struct {
+  Name   string `json:"name"`
+  Change string `json:"change"`
+  From   *T     `json:"from,omitempty"`
+  To     *T     `json:"to,omitempty"`
+}
+
+// a difference of a table. Only added and removed tables hold the
+// table itself, in To and From; changed ones hold what changed.
+type tableDiff struct {
+  Name        string                   `json:"name"`
+  Change      string                   `json:"change"`
+  View        bool                     `json:"view,omitempty"`
+  From        *Struct                  `json:"from,omitempty"`
+  To          *Struct                  `json:"to,omitempty"`
+  PrimaryKey  *objectDiff[[]string]    `json:"primary_key,omitempty"`
+  Columns     []objectDiff[Field]      `json:"columns,omitempty"`
+  Indexes     []objectDiff[Index]      `json:"indexes,omitempty"`
+  ForeignKeys []objectDiff[ForeignKey] `json:"foreign_keys,omitempty"`
+
+  src, dst Struct
+}
+
+// return the name of a table, schema qualified if it has a schema
+func qualifiedName(strct Struct) string {
+  if strct.Schema == "" {
+    return strct.Name
+  }
+  return strct.Schema + "." + strct.Name
+}
+
+// return the differences between the tables of src and dst, by name
+func diffSchemas(src, dst []Struct) []tableDiff {
+  dsts := make(map[string]Struct)
+  for _, strct := range dst {
+    dsts[qualifiedName(strct)] = strct
+  }
+
+  var diffs []tableDiff
+  seen := make(map[string]bool)
+  for _, a := range src {
+    name := qualifiedName(a)
+    seen[name] = true
+
+    b, ok := dsts[name]
+    if !ok {
+      a := a
+      diffs = append(diffs, tableDiff{Name: name, Change: "removed", View: a.View, From: &a, src: a})
+      continue
+    }
+    if d := diffTable(a, b); d.Change != "" {
+      diffs = append(diffs, d)
+    }
+  }
+  for _, b := range dst {
+    if name := qualifiedName(b); !seen[name] {
+      b := b
+      diffs = append(diffs, tableDiff{Name: name, Change: "added", View: b.View, To: &b, dst: b})
+    }
+  }
+
+  sort.SliceStable(diffs, func(i, j int) bool {
+    return diffs[i].Name < diffs[j].Name
+  })
+  return diffs
+}
+
+// report whether two columns have the same type, nullability, default
+// and auto increment
+func sameColumn(a, b Field) bool {
+  sameDefault := a.Default == nil && b.Default == nil ||
+    a.Default != nil && b.Default != nil && *a.Default == *b.Default
+  return strings.EqualFold(strings.Join(strings.Fields(a.SQLType), " "), strings.Join(strings.Fields(b.SQLType), " ")) &&
+    a.Nullable == b.Nullable && sameDefault && a.AutoIncrement == b.AutoIncrement
+}
+
+// the name a foreign key is matched by: its columns
+func foreignKeyKey(fk ForeignKey) string {
+  return strings.Join(fk.Columns, ",")
+}
+
+// return the name a foreign key is shown with: its own, or its columns
+// when it has none
+func foreignKeyName(fk ForeignKey) string {
+  if fk.Name != "" {
+    return fk.Name
+  }
+  return "(" + strings.Join(fk.Columns, ", ") + ")"
+}
+
+// diff the objects of two lists matched by key, keeping the order of a
+// and then b
+func diffObjects[T any](a, b []T, key func(T) string, name func(T) string, same func(T, T) bool) []objectDiff[T] {
+  bs := make(map[string]T)
+  for _, v := range b {
+    bs[key(v)] = v
+  }
+
+  var diffs []objectDiff[T]
+  seen := make(map[string]bool)
+  for _, v := range a {
+    v := v
+    seen[key(v)] = true
+    w, ok := bs[key(v)]
+    switch {
+    case !ok:
+      diffs = append(diffs, objectDiff[T]{Name: name(v), Change: "removed", From: &v})
+    case !same(v, w):
+      diffs = append(diffs, objectDiff[T]{Name: name(w), Change: "changed", From: &v, To: &w})
+    }
+  }
+  for _, w := range b {
+    w := w
+    if !seen[key(w)] {
+      diffs = append(diffs, objectDiff[T]{Name: name(w), Change: "added", To: &w})
+    }
+  }
+  return diffs
+}
+
+// the indexes of a struct but its primary key, which is diffed apart
+func secondaryIndexes(strct Struct) []Index {
+  var indexes []Index
+  for _, idx := range strct.Indexes {
+    if !idx.Primary {
+      indexes = append(indexes, idx)
+    }
+  }
+  return indexes
+}
+
+// return the differences between two versions of a table; its Change
+// is "" when there are none
+func diffTable(a, b Struct) tableDiff {
+  d := tableDiff{Name: qualifiedName(b), View: b.View, src: a, dst: b}
+
+  if strings.Join(a.PrimaryKey, ",") != strings.Join(b.PrimaryKey, ",") {
+    from, to := a.PrimaryKey, b.PrimaryKey
+    d.PrimaryKey = &objectDiff[[]string]{Name: "primary key", Change: "changed", From: &from, To: &to}
+  }
+
+  fieldName := func(f Field) string { return f.Name }
+  d.Columns = diffObjects(a.Fields, b.Fields, fieldName, fieldName, sameColumn)
+
+  indexName := func(idx Index) string { return idx.Name }
+  d.Indexes = diffObjects(secondaryIndexes(a), secondaryIndexes(b), indexName, indexName, func(x, y Index) bool {
+    return x.Unique == y.Unique && strings.Join(x.Columns, ",") == strings.Join(y.Columns, ",")
+  })
+
+  d.ForeignKeys = diffObjects(a.ForeignKeys, b.ForeignKeys, foreignKeyKey, foreignKeyName, func(x, y ForeignKey) bool {
+    return x.RefSchema == y.RefSchema && x.RefTable == y.RefTable &&
+      strings.Join(x.RefColumns, ",") == strings.Join(y.RefColumns, ",") &&
+      x.OnUpdate == y.OnUpdate && x.OnDelete == y.OnDelete
+  })
+
+  if d.PrimaryKey != nil || len(d.Columns) > 0 || len(d.Indexes) > 0 || len(d.ForeignKeys) > 0 || a.View != b.View {
+    d.Change = "changed"
+  }
+  return d
+}
+
+// the sign of a change in the text output
+var changeSigns = map[string]string{"added": "+", "removed": "-", "changed": "~"}
+
+// describe a column, e.g. "email varchar(100) NOT NULL DEFAULT 0"
+func describeColumn(f Field) string {
+  s := f.Name + " " + f.SQLType
+  if !f.Nullable {
+    s += " NOT NULL"
+  }
+  if f.Default != nil {
+    s += " DEFAULT " + *f.Default
+  }
+  if f.AutoIncrement {
+    s += " AUTO INCREMENT"
+  }
+  return s
+}
+
+// describe how a column changed, e.g. "type int -> bigint, NOT NULL -> nullable"
+func describeColumnChange(a, b Field) string {
+  var changes []string
+  if !strings.EqualFold(a.SQLType, b.SQLType) {
+    changes = append(changes, "type "+a.SQLType+" -> "+b.SQLType)
+  }
+  if a.Nullable != b.Nullable {
+    nullability := map[bool]string{true: "nullable", false: "NOT NULL"}
+    changes = append(changes, nullability[a.Nullable]+" -> "+nullability[b.Nullable])
+  }
+  def := func(d *string) string {
+    switch {
+    case d == nil:
+      return "none"
+    case *d == "":
+      return "''"
+    }
+    return *d
+  }
+  if def(a.Default) != def(b.Default) {
+    changes = append(changes, "default "+def(a.Default)+" -> "+def(b.Default))
+  }
+  if a.AutoIncrement != b.AutoIncrement {
+    changes = append(changes, fmt.Sprintf("auto increment %v -> %v", a.AutoIncrement, b.AutoIncrement))
+  }
+  return strings.Join(changes, ", ")
+}
+
+// describe an index, e.g. "unique (a, b)"
+func describeIndex(idx Index) string {
+  s := "(" + strings.Join(idx.Columns, ", ") + ")"
+  if idx.Unique {
+    s = "unique " + s
+  }
+  return s
+}
+
+// describe a foreign key, e.g.
+// "orders_user_id_fkey (user_id) -> users (id) ON UPDATE NO ACTION ON DELETE CASCADE"
+func describeForeignKey(fk ForeignKey) string {
+  ref := fk.RefTable
+  if fk.RefSchema != "" {
+    ref = fk.RefSchema + "." + ref
+  }
+  s := fmt.Sprintf("(%s) -> %s (%s) ON UPDATE %s ON DELETE %s", strings.Join(fk.Columns, ", "), ref,
+    strings.Join(fk.RefColumns, ", "), fk.OnUpdate, fk.OnDelete)
+  if fk.Name != "" {
+    s = fk.Name + " " + s
+  }
+  return s
+}
+
+// write the differences for people to read
+func writeDiff(w io.Writer, diffs []tableDiff) {
+  for _, d := range diffs {
+    kind := "table"
+    if d.View {
+      kind = "view"
+    }
+    fmt.Fprintf(w, "%s %s %s\n", changeSigns[d.Change], kind, d.Name)
+    if d.Change != "changed" {
+      continue
+    }
+
+    if d.src.View != d.dst.View {
+      fmt.Fprintf(w, "  ~ was a %s\n", map[bool]string{true: "view", false: "table"}[d.src.View])
+    }
+    if pk := d.PrimaryKey; pk != nil {
+      fmt.Fprintf(w, "  ~ primary key (%s) -> (%s)\n", strings.Join(*pk.From, ", "), strings.Join(*pk.To, ", "))
+    }
+    for _, c := range d.Columns {
+      switch c.Change {
+      case "added":
+        fmt.Fprintf(w, "  + column %s\n", describeColumn(*c.To))
+      case "removed":
+        fmt.Fprintf(w, "  - column %s\n", describeColumn(*c.From))
+      default:
+        fmt.Fprintf(w, "  ~ column %s: %s\n", c.Name, describeColumnChange(*c.From, *c.To))
+      }
+    }
+    for _, c := range d.Indexes {
+      switch c.Change {
+      case "added":
+        fmt.Fprintf(w, "  + index %s %s\n", c.Name, describeIndex(*c.To))
+      case "removed":
+        fmt.Fprintf(w, "  - index %s %s\n", c.Name, describeIndex(*c.From))
+      default:
+        fmt.Fprintf(w, "  ~ index %s %s -> %s\n", c.Name, describeIndex(*c.From), describeIndex(*c.To))
+      }
+    }
+    for _, c := range d.ForeignKeys {
+      switch c.Change {
+      case "added":
+        fmt.Fprintf(w, "  + foreign key %s\n", describeForeignKey(*c.To))
+      case "removed":
+        fmt.Fprintf(w, "  - foreign key %s\n", describeForeignKey(*c.From))
+      default:
+        fmt.Fprintf(w, "  ~ foreign key %s -> %s\n", describeForeignKey(*c.From), describeForeignKey(*c.To))
+      }
+    }
+  }
+}
+
+// return a column default as SQL. mysql reports literal defaults
+// without quotes.
+func (md *Metadata) defaultSQL(def string) string {
+  if md.Dialect != "mysql" {
+    return def
+  }
+  upper := strings.ToUpper(def)
+  if strings.HasPrefix(upper, "CURRENT_TIMESTAMP") || upper == "NULL" || strings.HasPrefix(def, "(") {
+    return def
+  }
+  if _, err := fmt.Sscanf(def, "%g", new(float64)); err == nil && strings.Trim(def, "0123456789.-+eE") == "" {
+    return def
+  }
+  return "'" + strings.Replace(strings.Replace(def, `\`, `\\`, -1), "'", "''", -1) + "'"
+}
+
+// return the definition of a column in a CREATE or ALTER TABLE
+func (md *Metadata) columnSQL(f Field) string {
+  typ, def := f.SQLType, f.Default
+
+  // auto incremented postgresql columns are serials or identities
+  if md.Dialect == "postgresql" && f.AutoIncrement {
+    serials := map[string]string{"smallint": "smallserial", "integer": "serial", "bigint": "bigserial"}
+    switch {
+    case def != nil && strings.HasPrefix(*def, "nextval(") && serials[typ] != "":
+      typ, def = serials[typ], nil
+    case def == nil:
+      typ += " GENERATED BY DEFAULT AS IDENTITY"
+    }
+  }
+
+  s := strings.TrimSpace(md.quote(f.Name) + " " + typ)
+  if !f.Nullable {
+    s += " NOT NULL"
+  }
+  if def != nil {
+    s += " DEFAULT " + md.defaultSQL(*def)
+  }
+  if md.Dialect == "mysql" && f.AutoIncrement {
+    s += " AUTO_INCREMENT"
+  }
+  return s
+}
+
+// return a quoted, comma separated list of names
+func (md *Metadata) quoteList(names []string) string {
+  var quoted []string
+  for _, name := range names {
+    quoted = append(quoted, md.quote(name))
+  }
+  return strings.Join(quoted, ", ")
+}
+
+// return the REFERENCES clause of a foreign key
+func (md *Metadata) referencesSQL(fk ForeignKey) string {
+  ref := md.table(Struct{Schema: fk.RefSchema, Name: fk.RefTable})
+  return fmt.Sprintf("FOREIGN KEY (%s) REFERENCES %s (%s) ON UPDATE %s ON DELETE %s",
+    md.quoteList(fk.Columns), ref, md.quoteList(fk.RefColumns), fk.OnUpdate, fk.OnDelete)
+}
+
+// return the statement creating a table, with its foreign keys for
+// sqlite3, which can not add them later
+func (md *Metadata) createTableSQL(strct Struct) string {
+  var defs []string
+  for _, f := range strct.Fields {
+    defs = append(defs, "  "+md.columnSQL(f))
+  }
+  if len(strct.PrimaryKey) > 0 {
+    defs = append(defs, "  PRIMARY KEY ("+md.quoteList(strct.PrimaryKey)+")")
+  }
+  if md.Dialect == "sqlite3" {
+    for _, fk := range strct.ForeignKeys {
+      defs = append(defs, "  "+md.referencesSQL(fk))
+    }
+  }
+  return "CREATE TABLE " + md.table(strct) + " (\n" + strings.Join(defs, ",\n") + "\n)"
+}
+
+// return the statement creating an index
+func (md *Metadata) createIndexSQL(strct Struct, idx Index) string {
+  for _, col := range idx.Columns {
+    if col == "" {
+      return fmt.Sprintf("-- the index %s of %s is on expressions, which are not known", idx.Name, qualifiedName(strct))
+    }
+  }
+  unique := ""
+  if idx.Unique {
+    unique = "UNIQUE "
+  }
+  return fmt.Sprintf("CREATE %sINDEX %s ON %s (%s)", unique, md.quote(idx.Name), md.table(strct), md.quoteList(idx.Columns))
+}
+
+// return the statements dropping an index
+func (md *Metadata) dropIndexSQL(strct Struct, idx Index) []string {
+  switch md.Dialect {
+  case "mysql":
+    return []string{fmt.Sprintf("DROP INDEX %s ON %s", md.quote(idx.Name), md.table(strct))}
+  case "postgresql":
+    // unique indexes may belong to a constraint
+    name := md.table(Struct{Schema: strct.Schema, Name: idx.Name})
+    return []string{
+      fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT IF EXISTS %s", md.table(strct), md.quote(idx.Name)),
+      "DROP INDEX IF EXISTS " + name,
+    }
+  }
+  return []string{"DROP INDEX " + md.quote(idx.Name)}
+}
+
+// return the statement adding a foreign key
+func (md *Metadata) addForeignKeySQL(strct Struct, fk ForeignKey) string {
+  if md.Dialect == "sqlite3" {
+    return fmt.Sprintf("-- sqlite3 can not add the foreign key %s to %s; the table must be rebuilt", foreignKeyName(fk), qualifiedName(strct))
+  }
+  constraint := ""
+  if fk.Name != "" {
+    constraint = "CONSTRAINT " + md.quote(fk.Name) + " "
+  }
+  return fmt.Sprintf("ALTER TABLE %s ADD %s%s", md.table(strct), constraint, md.referencesSQL(fk))
+}
+
+// return the statement dropping a foreign key
+func (md *Metadata) dropForeignKeySQL(strct Struct, fk ForeignKey) string {
+  switch {
+  case md.Dialect == "sqlite3" || fk.Name == "":
+    return fmt.Sprintf("-- %s can not drop the foreign key %s of %s; the table must be rebuilt", md.Dialect, foreignKeyName(fk), qualifiedName(strct))
+  case md.Dialect == "mysql":
+    return fmt.Sprintf("ALTER TABLE %s DROP FOREIGN KEY %s", md.table(strct), md.quote(fk.Name))
+  }
+  return fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", md.table(strct), md.quote(fk.Name))
+}
+
+// return the statements changing a column from a to b
+func (md *Metadata) alterColumnSQL(strct Struct, a, b Field) []string {
+  table := md.table(strct)
+  switch md.Dialect {
+  case "mysql":
+    return []string{fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s", table, md.columnSQL(b))}
+  case "postgresql":
+    col := md.quote(b.Name)
+    var stmts []string
+    if !strings.EqualFold(a.SQLType, b.SQLType) {
+      stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE %s USING %s::%s", table, col, b.SQLType, col, b.SQLType))
+    }
+    if a.Nullable != b.Nullable {
+      action := "SET NOT NULL"
+      if b.Nullable {
+        action = "DROP NOT NULL"
+      }
+      stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s %s", table, col, action))
+    }
+    switch {
+    case b.Default == nil && a.Default != nil:
+      stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s DROP DEFAULT", table, col))
+    case b.Default != nil && (a.Default == nil || *a.Default != *b.Default):
+      stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET DEFAULT %s", table, col, *b.Default))
+    }
+    if a.AutoIncrement != b.AutoIncrement && b.Default == nil {
+      action := "ADD GENERATED BY DEFAULT AS IDENTITY"
+      if !b.AutoIncrement {
+        action = "DROP IDENTITY IF EXISTS"
+      }
+      stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s %s", table, col, action))
+    }
+    return stmts
+  }
+  return []string{fmt.Sprintf("-- sqlite3 can not change the column %s of %s to %s; the table must be rebuilt",
+    b.Name, qualifiedName(strct), describeColumn(b))}
+}
+
+// return the statements changing the primary key of a table
+func (md *Metadata) alterPrimaryKeySQL(strct Struct, to []string) []string {
+  table := md.table(strct)
+  var stmts []string
+  switch md.Dialect {
+  case "sqlite3":
+    return []string{fmt.Sprintf("-- sqlite3 can not change the primary key of %s; the table must be rebuilt", qualifiedName(strct))}
+  case "mysql":
+    if len(strct.PrimaryKey) > 0 {
+      stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s DROP PRIMARY KEY", table))
+    }
+  case "postgresql":
+    for _, idx := range strct.Indexes {
+      if idx.Primary {
+        stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", table, md.quote(idx.Name)))
+      }
+    }
+  }
+  if len(to) > 0 {
+    stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s ADD PRIMARY KEY (%s)", table, md.quoteList(to)))
+  }
+  return stmts
+}
+
+// return the statements changing src into dst, in the dialect of md:
+// foreign keys and indexes are dropped first and added last, so that
+// the tables and columns they use exist
+func (md *Metadata) alterSQL(diffs []tableDiff) []string {
+  var dropKeys, dropIndexes, tables, columns, addIndexes, addKeys []string
+
+  for _, d := range diffs {
+    switch d.Change {
+    case "removed":
+      kind := "TABLE"
+      if d.View {
+        kind = "VIEW"
+      }
+      tables = append(tables, fmt.Sprintf("DROP %s %s", kind, md.table(d.src)))
+      continue
+
+    case "added":
+      if d.View {
+        tables = append(tables, fmt.Sprintf("-- the view %s can not be created: its definition is not known", d.Name))
+        continue
+      }
+      tables = append(tables, md.createTableSQL(d.dst))
+      for _, idx := range secondaryIndexes(d.dst) {
+        addIndexes = append(addIndexes, md.createIndexSQL(d.dst, idx))
+      }
+      if md.Dialect != "sqlite3" {
+        for _, fk := range d.dst.ForeignKeys {
+          addKeys = append(addKeys, md.addForeignKeySQL(d.dst, fk))
+        }
+      }
+      continue
+    }
+
+    if d.View || d.src.View {
+      tables = append(tables, fmt.Sprintf("-- the view %s differs; it must be recreated", d.Name))
+      continue
+    }
+
+    for _, c := range d.ForeignKeys {
+      if c.From != nil {
+        dropKeys = append(dropKeys, md.dropForeignKeySQL(d.src, *c.From))
+      }
+      if c.To != nil {
+        addKeys = append(addKeys, md.addForeignKeySQL(d.src, *c.To))
+      }
+    }
+    for _, c := range d.Indexes {
+      if c.From != nil {
+        dropIndexes = append(dropIndexes, md.dropIndexSQL(d.src, *c.From)...)
+      }
+      if c.To != nil {
+        addIndexes = append(addIndexes, md.createIndexSQL(d.src, *c.To))
+      }
+    }
+    for _, c := range d.Columns {
+      switch c.Change {
+      case "added":
+        columns = append(columns, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", md.table(d.src), md.columnSQL(*c.To)))
+      case "removed":
+        columns = append(columns, fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", md.table(d.src), md.quote(c.Name)))
+      default:
+        columns = append(columns, md.alterColumnSQL(d.src, *c.From, *c.To)...)
+      }
+    }
+    if d.PrimaryKey != nil {
+      columns = append(columns, md.alterPrimaryKeySQL(d.src, *d.PrimaryKey.To)...)
+    }
+  }
+
+  var stmts []string
+  for _, list := range [][]string{dropKeys, dropIndexes, tables, columns, addIndexes, addKeys} {
+    stmts = append(stmts, list...)
+  }
+  return stmts
+}
+
+// read the structs of a kdb diff source, see diffHelpMsg
+func readSource(source string) (*Metadata, error) {
+  md := &Metadata{}
+  if strings.HasSuffix(source, ".json") {
+    err := loadSchema(md, source)
+    md.filter()
+    return md, err
+  }
+
+  i := strings.Index(source, ":")
+  if i < 0 {
+    return nil, fmt.Errorf("bad source %q: expected <db>:<connect string or DDL> or a .json schema dump", source)
+  }
+  md.Dialect = source[:i]
+  switch md.Dialect {
+  case "mysql", "postgresql", "sqlite3":
+  default:
+    return nil, fmt.Errorf("bad source %q: unknown db %s", source, md.Dialect)
+  }
+
+  var err error
+  path := source[i+1:]
+  if fi, serr := os.Stat(path); serr == nil && (fi.IsDir() || strings.HasSuffix(path, ".sql")) {
+    err = ddl(md, path)
+  } else {
+    err = introspect(md, path)
+  }
+  if err != nil {
+    return nil, fmt.Errorf("%s: %v", source, err)
+  }
+
+  md.filter()
+  return md, nil
+}
+
+// run kdb diff with its arguments, returning the exit code: 1 when the
+// schemas differ and 2 on errors
+func diffCommand(args []string) int {
+  flags := goflag.NewFlagSet("kdb diff", goflag.ExitOnError)
+  asJSON := flags.Bool("json", false, "")
+  asSQL := flags.Bool("sql", false, "")
+  flags.Var(&tables, "tables", "")
+  flags.Var(&exclude, "exclude", "")
+  flags.Var(&views, "views", "")
+  flags.Var(&matviews, "matviews", "")
+  flags.Var(&schemas, "schema", "")
+  flags.Usage = func() {
+    fmt.Fprint(os.Stderr, strings.Replace(diffHelpMsg, "\\t", "\t", -1))
+  }
+  flags.Parse(args)
+
+  fail := func(err error) int {
+    fmt.Fprintln(os.Stderr, err)
+    return 2
+  }
+
+  if flags.NArg() != 2 {
+    flags.Usage()
+    return 2
+  }
+
+  src, err := readSource(flags.Arg(0))
+  if err != nil {
+    return fail(err)
+  }
+  dst, err := readSource(flags.Arg(1))
+  if err != nil {
+    return fail(err)
+  }
+
+  diffs := diffSchemas(src.Structs, dst.Structs)
+
+  switch {
+  case *asJSON:
+    out := struct {
+      Tables     []tableDiff `json:"tables"`
+      Statements []string    `json:"statements,omitempty"`
+    }{Tables: diffs}
+    if out.Tables == nil {
+      out.Tables = []tableDiff{}
+    }
+    if *asSQL {
+      out.Statements = src.alterSQL(diffs)
+    }
+    b, err := json.MarshalIndent(out, "", "  ")
+    if err != nil {
+      return fail(err)
+    }
+    fmt.Println(string(b))
+  case *asSQL:
+    for _, stmt := range src.alterSQL(diffs) {
+      if strings.HasPrefix(stmt, "--") {
+        fmt.Println(stmt)
+      } else {
+        fmt.Println(stmt + ";")
+      }
+    }
+  default:
+    writeDiff(os.Stdout, diffs)
+  }
+
+  if len(diffs) > 0 {
+    return 1
+  }
+  return 0
+}
@@ -2,156 +2,722 @@ package main
 
 import (
   "database/sql"
+  "errors"
   "fmt"
   "reflect"
   "strings"
 )
 
-// parses the mysql type string and returns
-// the basic type and its sign (if any)
+// parses the mysql column type (e.g. "int(10) unsigned") and
+// returns the basic type and its sign (if any)
 func parseMysqlType(s string) (typ string, sign string) {
-  fields := strings.Split(s, " ")
-  if len(fields) > 1 {
-    sign = fields[1]
+  typ, rest := s, ""
+  if i := strings.IndexAny(s, "( "); i >= 0 {
+    typ, rest = s[:i], s[i:]
   }
 
-  fields2 := strings.Split(fields[0], "(")
-  typ = fields2[0]
+  // skip the length or the enum/set values
+  if i := strings.LastIndex(rest, ")"); i >= 0 {
+    rest = rest[i+1:]
+  }
+  if strings.Contains(rest, "unsigned") {
+    sign = "unsigned"
+  }
 
   return
 }
 
+// parses the values of a mysql enum or set column type,
+// e.g. "enum('a','b')", where quotes in values are doubled
+func parseMysqlValues(s string) []string {
+  start := strings.Index(s, "(")
+  end := strings.LastIndex(s, ")")
+  if start < 0 || end < start {
+    return nil
+  }
+
+  var values []string
+  var value []rune
+  quoted := false
+  list := []rune(s[start+1 : end])
+  for i := 0; i < len(list); i++ {
+    switch c := list[i]; {
+    case c == '\'' && quoted && i+1 < len(list) && list[i+1] == '\'':
+      value = append(value, c)
+      i++
+    case c == '\'':
+      quoted = !quoted
+      if !quoted {
+        values = append(values, string(value))
+        value = value[:0]
+      }
+    case quoted:
+      value = append(value, c)
+    }
+  }
+
+  return values
+}
+
+// return the Go type for a mysql column
+func mysqlGoType(typ, sign string) reflect.Type {
+  switch typ {
+  case "tinyint", "smallint", "mediumint", "int", "bigint":
+    if sign == "unsigned" {
+      return reflect.TypeOf(uint64(0))
+    }
+    return reflect.TypeOf(int64(0))
+  case "decimal", "float", "double":
+    return reflect.TypeOf(float64(0))
+  case "blob", "tinyblob", "mediumblob", "longblob", "binary", "varbinary":
+    return reflect.TypeOf([]byte{})
+  case "date", "datetime", "timestamp":
+    return timeType
+  }
+
+  return reflect.TypeOf("")
+}
+
 // connect to mysql and return all
 // of the tables and their fields
 func mysql(md *Metadata, db *sql.DB) error {
-  rows, err := db.Query("show tables")
+  where, args := md.inSchemas("table_schema", "DATABASE()")
+  // table_comment is NULL for views on mysql 8
+  rows, err := db.Query(`SELECT table_schema, table_name, table_type, COALESCE(table_comment, '')
+    FROM information_schema.tables
+    WHERE `+where+`
+    ORDER BY table_schema, table_name`, args...)
   if err != nil {
     return err
   }
+  defer rows.Close()
 
-  var tables []string
-  var table string
+  // keyed by schema.table
+  tables := make(map[string]*Struct)
+  var names []string
   for rows.Next() {
-    rows.Scan(&table)
-    tables = append(tables, table)
+    var schema, table, ttype, comment string
+    err = rows.Scan(&schema, &table, &ttype, &comment)
+    if err != nil {
+      return err
+    }
+
+    tables[schema+"."+table] = &Struct{
+      Name:      table,
+      Schema:    tableSchema(schema),
+      CleanName: tableStructName(schema, table),
+      Comment:   comment,
+      View:      ttype == "VIEW",
+    }
+    names = append(names, schema+"."+table)
+  }
+  if err = rows.Err(); err != nil {
+    return err
   }
+  rows.Close()
 
-  for _, table := range tables {
-    rows, err := db.Query(fmt.Sprintf("show columns from %s", table))
+  rows, err = db.Query(`SELECT table_schema, table_name, column_name, column_type, is_nullable,
+      column_default, COALESCE(extra, ''), COALESCE(column_comment, ''), character_maximum_length
+    FROM information_schema.columns
+    WHERE `+where+`
+    ORDER BY table_schema, table_name, ordinal_position`, args...)
+  if err != nil {
+    return err
+  }
+  defer rows.Close()
+
+  for rows.Next() {
+    var schema, table, field, ctype, null, extra, comment string
+    var def sql.NullString
+    var length sql.NullInt64
+    err = rows.Scan(&schema, &table, &field, &ctype, &null, &def, &extra, &comment, &length)
     if err != nil {
       return err
     }
 
-    strct := Struct{
-      Name:      table,
-      CleanName: formatStructName(table),
+    strct, ok := tables[schema+"."+table]
+    if !ok {
+      continue
     }
-    var field, mtyp, null string
-    for rows.Next() {
-      rows.Scan(&field, &mtyp, &null, &null, &null, &null)
-
-      // default type
-      vtype := reflect.TypeOf("")
-
-      typ, _ := parseMysqlType(mtyp)
-      switch typ {
-      case "tinyint", "smallint", "mediumint", "int", "bigint":
-        // if sign == "unsigned" {
-        //   vtype = reflect.TypeOf(uint64(0))
-        // } else {
-        vtype = reflect.TypeOf(int64(0))
-        // }
-      case "decimal", "float", "double":
-        vtype = reflect.TypeOf(float64(0))
-      case "blob", "tinyblog", "mediumblob", "longblob":
-        vtype = reflect.TypeOf([]byte{})
-      }
 
-      strct.Fields = append(strct.Fields, Field{
-        Name:      field,
-        CleanName: formatFieldName(field),
-        Type:      vtype,
-      })
+    typ, sign := parseMysqlType(ctype)
+    f := Field{
+      Name:          field,
+      CleanName:     formatFieldName(field),
+      Type:          mysqlGoType(typ, sign),
+      Nullable:      null == "YES",
+      SQLType:       ctype,
+      Unsigned:      sign == "unsigned",
+      Comment:       comment,
+      AutoIncrement: strings.Contains(extra, "auto_increment"),
+      Length:        length.Int64,
+    }
+    if def.Valid {
+      f.Default = &def.String
+    }
+    if typ == "enum" || typ == "set" {
+      f.Values = parseMysqlValues(ctype)
     }
 
-    md.Structs = append(md.Structs, strct)
+    strct.Fields = append(strct.Fields, f)
+  }
+  if err = rows.Err(); err != nil {
+    return err
+  }
+  rows.Close()
+
+  rows, err = db.Query(`SELECT table_schema, table_name, column_name
+    FROM information_schema.key_column_usage
+    WHERE `+where+` AND constraint_name = 'PRIMARY'
+    ORDER BY table_schema, table_name, ordinal_position`, args...)
+  if err != nil {
+    return err
+  }
+  defer rows.Close()
+
+  for rows.Next() {
+    var schema, table, field string
+    err = rows.Scan(&schema, &table, &field)
+    if err != nil {
+      return err
+    }
+
+    if strct, ok := tables[schema+"."+table]; ok {
+      strct.setPrimaryKey(field)
+    }
+  }
+  if err = rows.Err(); err != nil {
+    return err
+  }
+  rows.Close()
+
+  // column_name is NULL for functional key parts
+  rows, err = db.Query(`SELECT table_schema, table_name, index_name, non_unique, column_name
+    FROM information_schema.statistics
+    WHERE `+where+`
+    ORDER BY table_schema, table_name, index_name, seq_in_index`, args...)
+  if err != nil {
+    return err
+  }
+  defer rows.Close()
+
+  for rows.Next() {
+    var schema, table, index string
+    var nonUnique int
+    var field sql.NullString
+    err = rows.Scan(&schema, &table, &index, &nonUnique, &field)
+    if err != nil {
+      return err
+    }
+
+    if strct, ok := tables[schema+"."+table]; ok {
+      strct.addIndexColumn(index, nonUnique == 0, index == "PRIMARY", field.String)
+    }
+  }
+  if err = rows.Err(); err != nil {
+    return err
+  }
+  rows.Close()
+
+  where, args = md.inSchemas("k.table_schema", "DATABASE()")
+  rows, err = db.Query(`SELECT k.table_schema, k.table_name, k.constraint_name, k.column_name,
+      k.referenced_table_schema, k.referenced_table_name, k.referenced_column_name,
+      r.update_rule, r.delete_rule
+    FROM information_schema.key_column_usage k
+    JOIN information_schema.referential_constraints r
+      ON r.constraint_schema = k.constraint_schema
+      AND r.constraint_name = k.constraint_name
+      AND r.table_name = k.table_name
+    WHERE `+where+` AND k.referenced_table_name IS NOT NULL
+    ORDER BY k.table_schema, k.table_name, k.constraint_name, k.ordinal_position`, args...)
+  if err != nil {
+    return err
+  }
+  defer rows.Close()
+
+  for rows.Next() {
+    var schema, table, name, field, refSchema, refTable, refField, onUpdate, onDelete string
+    err = rows.Scan(&schema, &table, &name, &field, &refSchema, &refTable, &refField, &onUpdate, &onDelete)
+    if err != nil {
+      return err
+    }
+
+    if strct, ok := tables[schema+"."+table]; ok {
+      strct.addForeignKeyColumn(name, field, tableSchema(refSchema), refTable, refField, onUpdate, onDelete)
+    }
+  }
+  if err = rows.Err(); err != nil {
+    return err
+  }
+
+  for _, name := range names {
+    md.Structs = append(md.Structs, *tables[name])
   }
 
   return nil
 }
 
+// return the Go type for a postgresql type name (pg_type.typname)
+func postgresqlGoType(typ string) reflect.Type {
+  switch typ {
+  case "int2", "int4", "int8":
+    return reflect.TypeOf(int64(0))
+  case "float4", "float8", "numeric":
+    return reflect.TypeOf(float64(0))
+  case "bool":
+    return reflect.TypeOf(true)
+  case "bytea":
+    return reflect.TypeOf([]byte{})
+  case "date", "timestamp", "timestamptz":
+    return timeType
+  }
+
+  return reflect.TypeOf("")
+}
+
+// return the referential action for a pg_constraint action code
+func postgresqlAction(code string) string {
+  switch code {
+  case "r":
+    return "RESTRICT"
+  case "c":
+    return "CASCADE"
+  case "n":
+    return "SET NULL"
+  case "d":
+    return "SET DEFAULT"
+  }
+  return "NO ACTION"
+}
+
 // connect to postgresql and return all
 // of the tables and their fields
 func postgresql(md *Metadata, db *sql.DB) error {
-  //"SELECT column_name, data_type FROM information_schema.columns WHERE table_name = ?"
+  where, args := md.inSchemas("n.nspname", "current_schema()")
+  rows, err := db.Query(`SELECT n.nspname, c.relname, c.relkind, coalesce(obj_description(c.oid, 'pg_class'), '')
+    FROM pg_class c
+    JOIN pg_namespace n ON n.oid = c.relnamespace
+    WHERE `+where+` AND c.relkind IN ('r', 'p', 'v', 'm')
+    ORDER BY n.nspname, c.relname`, args...)
+  if err != nil {
+    return err
+  }
+  defer rows.Close()
+
+  // keyed by schema.table
+  tables := make(map[string]*Struct)
+  var names []string
+  for rows.Next() {
+    var schema, table, kind, comment string
+    err = rows.Scan(&schema, &table, &kind, &comment)
+    if err != nil {
+      return err
+    }
+
+    tables[schema+"."+table] = &Struct{
+      Name:         table,
+      Schema:       tableSchema(schema),
+      CleanName:    tableStructName(schema, table),
+      Comment:      comment,
+      View:         kind == "v" || kind == "m",
+      Materialized: kind == "m",
+    }
+    names = append(names, schema+"."+table)
+  }
+  if err = rows.Err(); err != nil {
+    return err
+  }
+  rows.Close()
+
+  // atttypmod holds the length of character types plus 4
+  rows, err = db.Query(`SELECT n.nspname, c.relname, a.attname, format_type(a.atttypid, a.atttypmod), t.typname,
+      NOT a.attnotnull, pg_get_expr(d.adbin, d.adrelid), a.attidentity <> '',
+      coalesce(col_description(c.oid, a.attnum), ''),
+      CASE WHEN t.typname IN ('varchar', 'bpchar') AND a.atttypmod > 4 THEN a.atttypmod - 4 ELSE 0 END
+    FROM pg_attribute a
+    JOIN pg_class c ON c.oid = a.attrelid
+    JOIN pg_namespace n ON n.oid = c.relnamespace
+    JOIN pg_type t ON t.oid = a.atttypid
+    LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+    WHERE `+where+` AND c.relkind IN ('r', 'p', 'v', 'm')
+      AND a.attnum > 0 AND NOT a.attisdropped
+    ORDER BY n.nspname, c.relname, a.attnum`, args...)
+  if err != nil {
+    return err
+  }
+  defer rows.Close()
+
+  for rows.Next() {
+    var schema, table, field, ftype, typ, comment string
+    var nullable, identity bool
+    var def sql.NullString
+    var length int64
+    err = rows.Scan(&schema, &table, &field, &ftype, &typ, &nullable, &def, &identity, &comment, &length)
+    if err != nil {
+      return err
+    }
+
+    strct, ok := tables[schema+"."+table]
+    if !ok {
+      continue
+    }
+
+    f := Field{
+      Name:          field,
+      CleanName:     formatFieldName(field),
+      Type:          postgresqlGoType(typ),
+      Nullable:      nullable,
+      SQLType:       ftype,
+      Comment:       comment,
+      AutoIncrement: identity || strings.HasPrefix(def.String, "nextval("),
+      Length:        length,
+    }
+    if def.Valid {
+      f.Default = &def.String
+    }
+
+    strct.Fields = append(strct.Fields, f)
+  }
+  if err = rows.Err(); err != nil {
+    return err
+  }
+  rows.Close()
+
+  // attname is NULL for expressions (attnum 0)
+  rows, err = db.Query(`SELECT n.nspname, t.relname, i.relname, ix.indisunique, ix.indisprimary, a.attname
+    FROM pg_index ix
+    JOIN pg_class t ON t.oid = ix.indrelid
+    JOIN pg_class i ON i.oid = ix.indexrelid
+    JOIN pg_namespace n ON n.oid = t.relnamespace
+    CROSS JOIN LATERAL unnest(ix.indkey::int2[]) WITH ORDINALITY AS k(attnum, ord)
+    LEFT JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum
+    WHERE `+where+` AND k.ord <= ix.indnkeyatts
+    ORDER BY n.nspname, t.relname, i.relname, k.ord`, args...)
+  if err != nil {
+    return err
+  }
+  defer rows.Close()
+
+  for rows.Next() {
+    var schema, table, index string
+    var unique, primary bool
+    var field sql.NullString
+    err = rows.Scan(&schema, &table, &index, &unique, &primary, &field)
+    if err != nil {
+      return err
+    }
+
+    strct, ok := tables[schema+"."+table]
+    if !ok {
+      continue
+    }
+    strct.addIndexColumn(index, unique, primary, field.String)
+    if primary {
+      strct.setPrimaryKey(field.String)
+    }
+  }
+  if err = rows.Err(); err != nil {
+    return err
+  }
+  rows.Close()
+
+  rows, err = db.Query(`SELECT n.nspname, t.relname, c.conname, a.attname, rn.nspname, rt.relname, ra.attname,
+      c.confupdtype, c.confdeltype
+    FROM pg_constraint c
+    JOIN pg_class t ON t.oid = c.conrelid
+    JOIN pg_class rt ON rt.oid = c.confrelid
+    JOIN pg_namespace n ON n.oid = t.relnamespace
+    JOIN pg_namespace rn ON rn.oid = rt.relnamespace
+    CROSS JOIN LATERAL unnest(c.conkey, c.confkey) WITH ORDINALITY AS k(attnum, refattnum, ord)
+    JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = k.attnum
+    JOIN pg_attribute ra ON ra.attrelid = c.confrelid AND ra.attnum = k.refattnum
+    WHERE c.contype = 'f' AND `+where+`
+    ORDER BY n.nspname, t.relname, c.conname, k.ord`, args...)
+  if err != nil {
+    return err
+  }
+  defer rows.Close()
+
+  for rows.Next() {
+    var schema, table, name, field, refSchema, refTable, refField, onUpdate, onDelete string
+    err = rows.Scan(&schema, &table, &name, &field, &refSchema, &refTable, &refField, &onUpdate, &onDelete)
+    if err != nil {
+      return err
+    }
+
+    if strct, ok := tables[schema+"."+table]; ok {
+      strct.addForeignKeyColumn(name, field, tableSchema(refSchema), refTable, refField, postgresqlAction(onUpdate), postgresqlAction(onDelete))
+    }
+  }
+  if err = rows.Err(); err != nil {
+    return err
+  }
+
+  for _, name := range names {
+    md.Structs = append(md.Structs, *tables[name])
+  }
+
   return nil
 }
 
-// parses the sqlite3 type string and returns
-// the basic type
-func parseSqlite3Type(s string) (typ string, sign string) {
-  fields := strings.Split(s, "(")
-  typ = fields[0]
+// parses the sqlite3 declared type (e.g. "VARCHAR(30)") and
+// returns the basic type, its sign (if any) and its length
+func parseSqlite3Type(s string) (typ string, sign string, length int64) {
+  typ = strings.TrimSpace(s)
+  if i := strings.Index(typ, "("); i >= 0 {
+    fmt.Sscanf(typ[i+1:], "%d", &length)
+    typ = strings.TrimSpace(typ[:i])
+  }
 
-  if strings.Contains(s, "unsigned") {
+  if strings.Contains(typ, "unsigned") {
     sign = "unsigned"
   }
 
   return
 }
 
+// return the Go type for a sqlite3 declared type, following the
+// column affinity rules in http://www.sqlite.org/datatype3.html
+// (section 2.1). Types go-sqlite3 converts itself are checked first.
+func sqlite3GoType(typ string) reflect.Type {
+  switch typ {
+  case "date", "datetime", "timestamp":
+    return timeType
+  case "bit", "boolean", "bool":
+    return reflect.TypeOf(true)
+  }
+
+  switch {
+  case strings.Contains(typ, "int"):
+    return reflect.TypeOf(int64(0))
+  case strings.Contains(typ, "char"), strings.Contains(typ, "clob"), strings.Contains(typ, "text"):
+    return reflect.TypeOf("")
+  case strings.Contains(typ, "blob"), typ == "":
+    return reflect.TypeOf([]byte{})
+  }
+
+  // REAL and NUMERIC affinity
+  return reflect.TypeOf(float64(0))
+}
+
 func sqlite3(md *Metadata, db *sql.DB) error {
-  rows, err := db.Query("SELECT tbl_name FROM sqlite_master WHERE type = ?", "table")
+  if len(schemas) > 0 {
+    return errors.New("-schema is only supported for mysql and postgresql")
+  }
+
+  rows, err := db.Query(`SELECT name, type FROM sqlite_master
+    WHERE type IN ('table', 'view') AND name NOT LIKE 'sqlite\_%' ESCAPE '\'
+    ORDER BY name`)
   if err != nil {
     return err
   }
+  defer rows.Close()
 
-  var tables []string
-  var table string
+  var structs []Struct
   for rows.Next() {
-    rows.Scan(&table)
-    tables = append(tables, table)
-  }
-
-  for _, table := range tables {
-    rows, err := db.Query(fmt.Sprintf("PRAGMA TABLE_INFO('%s')", table))
+    var table, ttype string
+    err = rows.Scan(&table, &ttype)
     if err != nil {
       return err
     }
 
-    strct := Struct{
+    structs = append(structs, Struct{
       Name:      table,
       CleanName: formatStructName(table),
+      View:      ttype == "view",
+    })
+  }
+  if err = rows.Err(); err != nil {
+    return err
+  }
+  rows.Close()
+
+  for i := range structs {
+    err = sqlite3Columns(db, &structs[i])
+    if err != nil {
+      return err
     }
-    var field, styp, null string
-    for rows.Next() {
-      rows.Scan(&null, &field, &styp, &null, &null, &null)
-
-      // default type
-      vtype := reflect.TypeOf("")
-
-      typ, _ := parseSqlite3Type(strings.ToLower(styp))
-      switch typ {
-      case "int", "integer", "tinyint", "smallint", "mediumint", "bigint", "unsigned big int", "big int", "int2", "int8":
-        // if sign == "unsigned" {
-        //   vtype = reflect.TypeOf(uint64(0))
-        // } else {
-        vtype = reflect.TypeOf(int64(0))
-        // }
-      case "real", "double", "double precision", "float", "numeric", "decimal", "date", "datetime":
-        vtype = reflect.TypeOf(float64(0))
-      case "bit", "boolean", "bool":
-        vtype = reflect.TypeOf(true)
+    err = sqlite3ForeignKeys(db, &structs[i])
+    if err != nil {
+      return err
+    }
+    err = sqlite3Indexes(db, &structs[i])
+    if err != nil {
+      return err
+    }
+  }
+
+  // a foreign key without columns references the primary key
+  for i := range structs {
+    for j, fk := range structs[i].ForeignKeys {
+      if len(fk.RefColumns) > 0 {
+        continue
+      }
+      for _, ref := range structs {
+        if ref.Name == fk.RefTable {
+          structs[i].ForeignKeys[j].RefColumns = ref.PrimaryKey
+        }
       }
+    }
+  }
 
-      strct.Fields = append(strct.Fields, Field{
-        Name:      field,
-        CleanName: formatFieldName(field),
-        Type:      vtype,
+  md.Structs = append(md.Structs, structs...)
+
+  return nil
+}
+
+// read the columns of a sqlite3 table or view
+func sqlite3Columns(db *sql.DB, strct *Struct) error {
+  rows, err := db.Query(`SELECT name, type, "notnull", dflt_value, pk
+    FROM pragma_table_info(?) ORDER BY cid`, strct.Name)
+  if err != nil {
+    return err
+  }
+  defer rows.Close()
+
+  var pks []string
+  for rows.Next() {
+    var notnull, pk int
+    var field, styp string
+    var def sql.NullString
+    err = rows.Scan(&field, &styp, &notnull, &def, &pk)
+    if err != nil {
+      return err
+    }
+
+    typ, sign, length := parseSqlite3Type(strings.ToLower(styp))
+
+    // sqlite only reports notnull when it was declared, but
+    // we treat primary keys as required.
+    f := Field{
+      Name:       field,
+      CleanName:  formatFieldName(field),
+      Type:       sqlite3GoType(typ),
+      Nullable:   notnull == 0 && pk == 0,
+      SQLType:    styp,
+      Unsigned:   sign == "unsigned",
+      PrimaryKey: pk > 0,
+    }
+    if f.Type.Kind() == reflect.String {
+      f.Length = length
+    }
+    if def.Valid {
+      f.Default = &def.String
+    }
+    strct.Fields = append(strct.Fields, f)
+
+    // pk is the 1 based position of the column in the primary key
+    if pk > 0 {
+      for len(pks) < pk {
+        pks = append(pks, "")
+      }
+      pks[pk-1] = field
+    }
+  }
+  if err = rows.Err(); err != nil {
+    return err
+  }
+
+  strct.PrimaryKey = pks
+
+  // an INTEGER PRIMARY KEY is an alias for the rowid
+  if len(pks) == 1 {
+    for i, f := range strct.Fields {
+      if f.PrimaryKey && strings.EqualFold(f.SQLType, "integer") {
+        strct.Fields[i].AutoIncrement = true
+      }
+    }
+  }
+
+  return nil
+}
+
+// read the foreign keys of a sqlite3 table
+func sqlite3ForeignKeys(db *sql.DB, strct *Struct) error {
+  rows, err := db.Query(`SELECT id, "table", "from", "to", on_update, on_delete
+    FROM pragma_foreign_key_list(?) ORDER BY id, seq`, strct.Name)
+  if err != nil {
+    return err
+  }
+  defer rows.Close()
+
+  lastID := -1
+  for rows.Next() {
+    var id int
+    var table, from, onUpdate, onDelete string
+    var to sql.NullString
+    err = rows.Scan(&id, &table, &from, &to, &onUpdate, &onDelete)
+    if err != nil {
+      return err
+    }
+
+    if id != lastID {
+      strct.ForeignKeys = append(strct.ForeignKeys, ForeignKey{
+        RefTable: table,
+        OnUpdate: onUpdate,
+        OnDelete: onDelete,
       })
+      lastID = id
+    }
+
+    fk := &strct.ForeignKeys[len(strct.ForeignKeys)-1]
+    fk.Columns = append(fk.Columns, from)
+    if to.Valid {
+      fk.RefColumns = append(fk.RefColumns, to.String)
+    }
+  }
+
+  return rows.Err()
+}
+
+// read the indexes of a sqlite3 table
+func sqlite3Indexes(db *sql.DB, strct *Struct) error {
+  rows, err := db.Query(`SELECT name, "unique", origin
+    FROM pragma_index_list(?) ORDER BY name`, strct.Name)
+  if err != nil {
+    return err
+  }
+  defer rows.Close()
+
+  var indexes []Index
+  for rows.Next() {
+    var idx Index
+    var origin string
+    err = rows.Scan(&idx.Name, &idx.Unique, &origin)
+    if err != nil {
+      return err
+    }
+    idx.Primary = origin == "pk"
+    indexes = append(indexes, idx)
+  }
+  if err = rows.Err(); err != nil {
+    return err
+  }
+  rows.Close()
+
+  for _, idx := range indexes {
+    rows, err := db.Query("SELECT name FROM pragma_index_info(?) ORDER BY seqno", idx.Name)
+    if err != nil {
+      return err
+    }
+
+    for rows.Next() {
+      // name is NULL for expressions
+      var name sql.NullString
+      err = rows.Scan(&name)
+      if err != nil {
+        rows.Close()
+        return err
+      }
+      idx.Columns = append(idx.Columns, name.String)
+    }
+    err = rows.Err()
+    rows.Close()
+    if err != nil {
+      return err
     }
 
-    md.Structs = append(md.Structs, strct)
+    strct.Indexes = append(strct.Indexes, idx)
   }
 
   return nil
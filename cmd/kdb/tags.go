@@ -0,0 +1,127 @@
+package main
+
+import (
+  "fmt"
+  "strconv"
+  "strings"
+)
+
+// a struct tag to output, e.g. "json:camel" is the json tag holding
+// the column name in camel case
+type tagSpec struct {
+  key   string
+  style string // asis, snake, camel or pascal
+}
+
+// the tags that get ",omitempty" for nullable columns with -omitempty
+var omitemptyTags = map[string]bool{"json": true, "yaml": true, "xml": true, "toml": true}
+
+// parse a -tags value: comma separated keys, each optionally followed
+// by a colon and a naming style. -sqlstruct adds the sql tag.
+func parseTags(s string) ([]tagSpec, error) {
+  var specs []tagSpec
+  seen := make(map[string]bool)
+  for _, v := range strings.Split(s, ",") {
+    v = strings.TrimSpace(v)
+    if v == "" {
+      continue
+    }
+
+    spec := tagSpec{key: v, style: "asis"}
+    if i := strings.Index(v, ":"); i >= 0 {
+      spec.key, spec.style = v[:i], v[i+1:]
+    }
+    switch spec.style {
+    case "asis", "snake", "camel", "pascal":
+    default:
+      return nil, fmt.Errorf("unknown naming style %q for tag %s", spec.style, spec.key)
+    }
+    if spec.key == "" || strings.ContainsAny(spec.key, " \"`") {
+      return nil, fmt.Errorf("bad tag %q", v)
+    }
+
+    if !seen[spec.key] {
+      specs = append(specs, spec)
+      seen[spec.key] = true
+    }
+  }
+
+  if *sqlstruct && !seen["sql"] {
+    specs = append(specs, tagSpec{key: "sql", style: "asis"})
+  }
+
+  return specs, nil
+}
+
+// return the column name in a naming style
+func styleName(name, style string) string {
+  var words []string
+  for _, part := range strings.Split(identifierChars(name), "_") {
+    words = append(words, splitWords(part)...)
+  }
+  if len(words) == 0 {
+    return name
+  }
+
+  switch style {
+  case "snake":
+    for i, w := range words {
+      words[i] = strings.ToLower(w)
+    }
+    return strings.Join(words, "_")
+  case "camel", "pascal":
+    for i, w := range words {
+      words[i] = capitalize(strings.ToLower(w))
+    }
+    if style == "camel" {
+      words[0] = strings.ToLower(words[0])
+    }
+    return strings.Join(words, "")
+  }
+  return name
+}
+
+// return the gorm tag of a field: its column, and whether it is
+// (part of) the primary key, auto incremented, sized or not null. The
+// column is always the real column name, as gorm queries by it.
+func gormTag(field Field) string {
+  parts := []string{"column:" + field.Name}
+  if field.PrimaryKey {
+    parts = append(parts, "primaryKey")
+  }
+  if field.AutoIncrement {
+    parts = append(parts, "autoIncrement")
+  }
+  if field.Length > 0 {
+    parts = append(parts, "size:"+strconv.FormatInt(field.Length, 10))
+  }
+  if !field.Nullable && !field.PrimaryKey {
+    parts = append(parts, "not null")
+  }
+  return strings.Join(parts, ";")
+}
+
+// return the struct tag of a field according to -tags, -sqlstruct and
+// -omitempty, with its backquotes, or "" if there is none
+func fieldTag(field Field) string {
+  specs, _ := parseTags(*tagsFlag)
+
+  var tags []string
+  for _, spec := range specs {
+    name := styleName(field.Name, spec.style)
+
+    value := name
+    switch {
+    case spec.key == "gorm":
+      value = gormTag(field)
+    case omitemptyTags[spec.key] && *omitempty && field.Nullable:
+      value += ",omitempty"
+    }
+    tags = append(tags, spec.key+":"+strconv.Quote(value))
+  }
+
+  if len(tags) == 0 {
+    return ""
+  }
+  return "`" + strings.Join(tags, " ") + "`"
+}
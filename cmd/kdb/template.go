@@ -0,0 +1,121 @@
+package main
+
+import (
+  _ "embed"
+  "fmt"
+  "os"
+  "path/filepath"
+  "strings"
+  "text/template"
+)
+
+// The code is generated by executing a text/template with the
+// *Metadata after Create(). Templates see:
+//
+//  .Args          the command line kdb was run with
+//  .Package       the package name
+//  .Dialect       mysql, postgresql or sqlite3
+//  .Structs       the tables and views, see Struct, Field, Index and
+//                 ForeignKey in metadata.go
+//  .Imports       the packages the generated code needs, as map keys
+//  .CrudCode      the -crud functions
+//  .FinderCode    the -finders functions
+//  .RelationCode  the -relations methods
+//
+// and the functions in funcs. The output must be Go source; it is run
+// through gofmt.
+//
+//go:embed templates/default.tmpl
+var defaultTemplate string
+
+// the functions available to templates
+func (md *Metadata) funcs() template.FuncMap {
+  return template.FuncMap{
+    // strings
+    "join":    strings.Join,
+    "oneLine": oneLine,
+
+    // naming: formatName takes a list of formats like -structname
+    "capitalize":   capitalize,
+    "lowercase":    lowercase,
+    "nounderscore": nounderscore,
+    "camel":        camel,
+    "initialisms":  initialisms,
+    "singular":     singular,
+    "formatName":   formatName,
+    "structName":   formatStructName,
+    "fieldName":    formatFieldName,
+
+    // types: the Go type of a field according to -types and -nulltype
+    "goType": md.goType,
+
+    // sql for the dialect
+    "quote":       md.quote,
+    "placeholder": md.placeholder,
+    "selectSQL":   md.selectSQL,
+    "insertSQL":   md.insertSQL,
+    "updateSQL":   md.updateSQL,
+    "deleteSQL":   md.deleteSQL,
+
+    // keys
+    "pkFields":    pkFields,
+    "nonPkFields": nonPkFields,
+    "references":  references,
+
+    // the schema fingerprint of a struct, see -verify
+    "fingerprint": fingerprint,
+
+    // the struct tag of a field according to -tags, with backquotes
+    "tag": fieldTag,
+
+    // flags
+    "omitgen":   func() bool { return *omitgen },
+    "sqlstruct": func() bool { return *sqlstruct },
+    "verify":    func() bool { return *verify },
+  }
+}
+
+// return the template to execute. The default template is always
+// parsed first so that -template files can redefine the templates it
+// defines. A file is executed itself. All the *.tmpl files of a
+// directory are parsed and main.tmpl is executed if there is one,
+// otherwise the default template is, using what the files redefined.
+func (md *Metadata) template(path string) (*template.Template, error) {
+  t, err := template.New("default.tmpl").Funcs(md.funcs()).Parse(defaultTemplate)
+  if err != nil {
+    return nil, err
+  }
+  if path == "" {
+    return t, nil
+  }
+
+  fi, err := os.Stat(path)
+  if err != nil {
+    return nil, err
+  }
+
+  if !fi.IsDir() {
+    _, err = t.ParseFiles(path)
+    if err != nil {
+      return nil, err
+    }
+    return t.Lookup(filepath.Base(path)), nil
+  }
+
+  files, err := filepath.Glob(filepath.Join(path, "*.tmpl"))
+  if err != nil {
+    return nil, err
+  }
+  if len(files) == 0 {
+    return nil, fmt.Errorf("no *.tmpl files in %s", path)
+  }
+
+  _, err = t.ParseFiles(files...)
+  if err != nil {
+    return nil, err
+  }
+  if main := t.Lookup("main.tmpl"); main != nil {
+    return main, nil
+  }
+  return t, nil
+}
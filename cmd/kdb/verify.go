@@ -0,0 +1,38 @@
+package main
+
+import (
+  "strings"
+)
+
+// return a name of a schema fingerprint, double quoted if needed
+func fingerprintName(name string) string {
+  if name != "" && !strings.ContainsAny(name, " .(),?\"\t\n") {
+    return name
+  }
+  return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// return the schema fingerprint of a struct's table that the -verify
+// code checks with kdb.VerifySchema, e.g.
+// "users(id bigint, email character varying(100)?)". A column without
+// a type, which sqlite allows, has the type "".
+func fingerprint(strct Struct) string {
+  var cols []string
+  for _, f := range strct.Fields {
+    typ := f.SQLType
+    if typ == "" {
+      typ = `""`
+    }
+    col := fingerprintName(f.Name) + " " + typ
+    if f.Nullable {
+      col += "?"
+    }
+    cols = append(cols, col)
+  }
+
+  table := fingerprintName(strct.Name)
+  if strct.Schema != "" {
+    table = fingerprintName(strct.Schema) + "." + table
+  }
+  return table + "(" + strings.Join(cols, ", ") + ")"
+}
@@ -0,0 +1,275 @@
+package kdb
+
+import (
+  "context"
+  "database/sql"
+  "sync"
+)
+
+// Querier is implemented by *sql.DB, *sql.Tx, *DB and *Tx. All of
+// the query helpers in this package accept a Querier.
+type Querier interface {
+  Exec(query string, args ...interface{}) (sql.Result, error)
+  ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+  Query(query string, args ...interface{}) (*sql.Rows, error)
+  QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// rowsQuerier is implemented by *DB and *Tx, whose hooks are called
+// once the helpers have read the rows of a query.
+type rowsQuerier interface {
+  queryRows(ctx context.Context, query string, args []interface{}) (*sql.Rows, func() error, error)
+}
+
+// queryRows runs query on db for the helpers reading its rows. The
+// returned function closes the rows and must be called once they have
+// been read.
+func queryRows(db Querier, query string, args []interface{}) (*sql.Rows, func() error, error) {
+  if q, ok := db.(rowsQuerier); ok {
+    return q.queryRows(context.Background(), query, args)
+  }
+  rows, err := db.Query(query, args...)
+  if err != nil {
+    return nil, nil, err
+  }
+  return rows, rows.Close, nil
+}
+
+// DB is a kdb handle around a *sql.DB. Every query and statement
+// executed through it is passed to the registered hooks, and, when
+// enabled with SetStmtCacheSize, run as a cached prepared statement.
+type DB struct {
+  *sql.DB
+  hooks []Hook
+  stmts *stmtCache
+}
+
+// Open opens a database and wraps it in a kdb handle.
+func Open(driverName, dataSourceName string) (*DB, error) {
+  db, err := sql.Open(driverName, dataSourceName)
+  if err != nil {
+    return nil, err
+  }
+  return New(db), nil
+}
+
+// New wraps an already opened *sql.DB in a kdb handle.
+func New(db *sql.DB) *DB {
+  return &DB{DB: db}
+}
+
+// AddHook registers hooks on the handle. Hooks are called in the
+// order they were added. AddHook is not safe to call while the
+// handle is being used.
+func (db *DB) AddHook(hooks ...Hook) {
+  db.hooks = append(db.hooks, hooks...)
+}
+
+// SetStmtCacheSize enables caching of up to n prepared statements,
+// keyed by their SQL text. Statements are prepared the first time a
+// query is run and the least recently used ones are closed once the
+// cache is full. n <= 0 disables the cache. Like AddHook, it is not
+// safe to call while the handle is being used.
+func (db *DB) SetStmtCacheSize(n int) {
+  if db.stmts != nil {
+    db.stmts.close()
+    db.stmts = nil
+  }
+  if n > 0 {
+    db.stmts = newStmtCache(db.DB, n)
+  }
+}
+
+// Close closes the cached statements and the database.
+func (db *DB) Close() error {
+  if db.stmts != nil {
+    db.stmts.close()
+  }
+  return db.DB.Close()
+}
+
+func (db *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
+  return db.ExecContext(context.Background(), query, args...)
+}
+
+func (db *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+  return runExec(ctx, db.hooks, query, args, func(ctx context.Context) (sql.Result, error) {
+    if db.stmts != nil {
+      return withStmt(ctx, db.stmts, nil, query, func(s *sql.Stmt) (sql.Result, error) {
+        return s.ExecContext(ctx, args...)
+      })
+    }
+    return db.DB.ExecContext(ctx, query, args...)
+  })
+}
+
+func (db *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+  return db.QueryContext(context.Background(), query, args...)
+}
+
+func (db *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+  return runQuery(ctx, db.hooks, query, args, func(ctx context.Context) (*sql.Rows, error) {
+    return db.query(ctx, query, args)
+  })
+}
+
+func (db *DB) queryRows(ctx context.Context, query string, args []interface{}) (*sql.Rows, func() error, error) {
+  return runRows(ctx, db.hooks, query, args, func(ctx context.Context) (*sql.Rows, error) {
+    return db.query(ctx, query, args)
+  })
+}
+
+func (db *DB) query(ctx context.Context, query string, args []interface{}) (*sql.Rows, error) {
+  if db.stmts != nil {
+    return withStmt(ctx, db.stmts, nil, query, func(s *sql.Stmt) (*sql.Rows, error) {
+      return s.QueryContext(ctx, args...)
+    })
+  }
+  return db.DB.QueryContext(ctx, query, args...)
+}
+
+func (db *DB) QueryRow(query string, args ...interface{}) *sql.Row {
+  return db.QueryRowContext(context.Background(), query, args...)
+}
+
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+  return runQueryRow(ctx, db.hooks, query, args, func(ctx context.Context) *sql.Row {
+    if db.stmts != nil {
+      row, _ := withStmt(ctx, db.stmts, nil, query, func(s *sql.Stmt) (*sql.Row, error) {
+        row := s.QueryRowContext(ctx, args...)
+        return row, row.Err()
+      })
+      if row != nil {
+        return row
+      }
+      // the statement could not be prepared, let database/sql
+      // report the error when the row is scanned
+    }
+    return db.DB.QueryRowContext(ctx, query, args...)
+  })
+}
+
+func (db *DB) Begin() (*Tx, error) {
+  return db.BeginTx(context.Background(), nil)
+}
+
+// BeginTx starts a transaction. Queries run on the returned *Tx are
+// passed to the same hooks as the handle.
+func (db *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+  tx, err := db.DB.BeginTx(ctx, opts)
+  if err != nil {
+    return nil, err
+  }
+  return &Tx{Tx: tx, hooks: db.hooks, cache: db.stmts}, nil
+}
+
+// Tx is a transaction started from a kdb handle. When the handle
+// caches statements, they are bound to the transaction with tx.Stmt,
+// and the ones not cached yet are prepared on the transaction.
+type Tx struct {
+  *sql.Tx
+  hooks []Hook
+  cache *stmtCache
+
+  mu    sync.Mutex
+  stmts map[string]*sql.Stmt
+}
+
+// bind returns the statement for query bound to the transaction,
+// reusing an earlier one. stmt is the cached statement for query, or
+// nil if it is not cached: the query is then prepared on the
+// transaction and not cached, as preparing it on the handle would
+// wait for another connection and not see the tables the transaction
+// created.
+func (tx *Tx) bind(ctx context.Context, query string, stmt *sql.Stmt) (*sql.Stmt, error) {
+  tx.mu.Lock()
+  defer tx.mu.Unlock()
+
+  if s, ok := tx.stmts[query]; ok {
+    return s, nil
+  }
+  if tx.stmts == nil {
+    tx.stmts = make(map[string]*sql.Stmt)
+  }
+
+  // closed by database/sql when the transaction ends
+  var s *sql.Stmt
+  if stmt != nil {
+    s = tx.Tx.StmtContext(ctx, stmt)
+  } else {
+    var err error
+    s, err = tx.Tx.PrepareContext(ctx, query)
+    if err != nil {
+      return nil, err
+    }
+  }
+  tx.stmts[query] = s
+  return s, nil
+}
+
+func (tx *Tx) unbind(query string) {
+  tx.mu.Lock()
+  defer tx.mu.Unlock()
+  delete(tx.stmts, query)
+}
+
+func (tx *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
+  return tx.ExecContext(context.Background(), query, args...)
+}
+
+func (tx *Tx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+  return runExec(ctx, tx.hooks, query, args, func(ctx context.Context) (sql.Result, error) {
+    if tx.cache != nil {
+      return withStmt(ctx, tx.cache, tx, query, func(s *sql.Stmt) (sql.Result, error) {
+        return s.ExecContext(ctx, args...)
+      })
+    }
+    return tx.Tx.ExecContext(ctx, query, args...)
+  })
+}
+
+func (tx *Tx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+  return tx.QueryContext(context.Background(), query, args...)
+}
+
+func (tx *Tx) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+  return runQuery(ctx, tx.hooks, query, args, func(ctx context.Context) (*sql.Rows, error) {
+    return tx.query(ctx, query, args)
+  })
+}
+
+func (tx *Tx) queryRows(ctx context.Context, query string, args []interface{}) (*sql.Rows, func() error, error) {
+  return runRows(ctx, tx.hooks, query, args, func(ctx context.Context) (*sql.Rows, error) {
+    return tx.query(ctx, query, args)
+  })
+}
+
+func (tx *Tx) query(ctx context.Context, query string, args []interface{}) (*sql.Rows, error) {
+  if tx.cache != nil {
+    return withStmt(ctx, tx.cache, tx, query, func(s *sql.Stmt) (*sql.Rows, error) {
+      return s.QueryContext(ctx, args...)
+    })
+  }
+  return tx.Tx.QueryContext(ctx, query, args...)
+}
+
+func (tx *Tx) QueryRow(query string, args ...interface{}) *sql.Row {
+  return tx.QueryRowContext(context.Background(), query, args...)
+}
+
+func (tx *Tx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+  return runQueryRow(ctx, tx.hooks, query, args, func(ctx context.Context) *sql.Row {
+    if tx.cache != nil {
+      row, _ := withStmt(ctx, tx.cache, tx, query, func(s *sql.Stmt) (*sql.Row, error) {
+        row := s.QueryRowContext(ctx, args...)
+        return row, row.Err()
+      })
+      if row != nil {
+        return row
+      }
+      // the statement could not be prepared, let database/sql
+      // report the error when the row is scanned
+    }
+    return tx.Tx.QueryRowContext(ctx, query, args...)
+  })
+}
@@ -0,0 +1,319 @@
+package kdb
+
+import (
+  "errors"
+  "fmt"
+  "reflect"
+  "regexp"
+  "strings"
+)
+
+// ErrorKind classifies a database error independently of the driver
+// that produced it.
+type ErrorKind int
+
+const (
+  KindUnknown ErrorKind = iota
+  KindUniqueViolation
+  KindForeignKeyViolation
+  KindNotNullViolation
+  KindDeadlock
+  KindSerializationFailure
+)
+
+func (k ErrorKind) String() string {
+  switch k {
+  case KindUniqueViolation:
+    return "unique violation"
+  case KindForeignKeyViolation:
+    return "foreign key violation"
+  case KindNotNullViolation:
+    return "not null violation"
+  case KindDeadlock:
+    return "deadlock"
+  case KindSerializationFailure:
+    return "serialization failure"
+  }
+  return "unknown"
+}
+
+// DBError is a driver independent view of an error returned by
+// the mysql, postgresql or sqlite3 drivers. Constraint, Table and
+// Column are filled in when the driver (or its error message)
+// makes them available.
+type DBError struct {
+  Kind       ErrorKind
+  Driver     string // "mysql", "postgresql" or "sqlite3"
+  Code       string // driver specific error code (e.g. "1062", "23505")
+  Message    string
+  Constraint string
+  Table      string
+  Column     string
+  Err        error // the original driver error
+}
+
+func (e *DBError) Error() string {
+  return e.Err.Error()
+}
+
+func (e *DBError) Unwrap() error {
+  return e.Err
+}
+
+// pgError is satisfied by the errors of both github.com/bmizerany/pq
+// and github.com/lib/pq, so we don't need to import either.
+type pgError interface {
+  error
+  Get(k byte) string
+}
+
+// mysqlError holds what we use of a *mysql.MySQLError and sqlite3Error
+// of a sqlite3.Error. They are read by reflection (see driverError)
+// rather than by importing the drivers, which would register them in
+// every program using kdb and make go-sqlite3 need cgo.
+type mysqlError struct {
+  err     error
+  number  uint16
+  message string
+}
+
+type sqlite3Error struct {
+  err          error
+  extendedCode int
+}
+
+// the sqlite3 extended result codes we classify, see
+// https://www.sqlite.org/rescode.html
+const (
+  sqlite3ConstraintForeignKey = 787
+  sqlite3ConstraintNotNull    = 1299
+  sqlite3ConstraintPrimaryKey = 1555
+  sqlite3ConstraintUnique     = 2067
+  sqlite3BusySnapshot         = 517
+)
+
+// return the first error in the chain of err whose type, less a
+// pointer, is a struct named name of a package whose path holds pkg,
+// with the given fields, and the values of those fields
+func driverError(err error, pkg, name string, fields ...string) (error, []reflect.Value) {
+  for err != nil {
+    v := reflect.ValueOf(err)
+    if v.Kind() == reflect.Ptr && !v.IsNil() {
+      v = v.Elem()
+    }
+    if v.Kind() == reflect.Struct && v.Type().Name() == name &&
+      strings.Contains(strings.ToLower(v.Type().PkgPath()), pkg) {
+      var values []reflect.Value
+      for _, field := range fields {
+        f := v.FieldByName(field)
+        if !f.IsValid() {
+          break
+        }
+        values = append(values, f)
+      }
+      if len(values) == len(fields) {
+        return err, values
+      }
+    }
+
+    switch u := err.(type) {
+    case interface{ Unwrap() error }:
+      err = u.Unwrap()
+    case interface{ Unwrap() []error }:
+      for _, e := range u.Unwrap() {
+        if found, values := driverError(e, pkg, name, fields...); found != nil {
+          return found, values
+        }
+      }
+      return nil, nil
+    default:
+      return nil, nil
+    }
+  }
+  return nil, nil
+}
+
+// find a *mysql.MySQLError in the chain of err
+func asMysqlError(err error) (mysqlError, bool) {
+  found, values := driverError(err, "mysql", "MySQLError", "Number", "Message")
+  if found == nil || values[0].Kind() != reflect.Uint16 || values[1].Kind() != reflect.String {
+    return mysqlError{}, false
+  }
+  return mysqlError{found, uint16(values[0].Uint()), values[1].String()}, true
+}
+
+// find a sqlite3.Error in the chain of err
+func asSqlite3Error(err error) (sqlite3Error, bool) {
+  found, values := driverError(err, "sqlite3", "Error", "Code", "ExtendedCode")
+  if found == nil || values[1].Kind() != reflect.Int {
+    return sqlite3Error{}, false
+  }
+  return sqlite3Error{found, int(values[1].Int())}, true
+}
+
+// AsDBError converts err into a *DBError if it is (or wraps) an error
+// from one of the supported drivers.
+func AsDBError(err error) (*DBError, bool) {
+  if err == nil {
+    return nil, false
+  }
+
+  var dbErr *DBError
+  if errors.As(err, &dbErr) {
+    return dbErr, true
+  }
+
+  if myErr, ok := asMysqlError(err); ok {
+    return fromMysql(myErr), true
+  }
+
+  if liteErr, ok := asSqlite3Error(err); ok {
+    return fromSqlite3(liteErr), true
+  }
+
+  var pErr pgError
+  if errors.As(err, &pErr) && pErr.Get('C') != "" {
+    return fromPostgresql(pErr), true
+  }
+
+  return nil, false
+}
+
+func kindOf(err error) ErrorKind {
+  if dbErr, ok := AsDBError(err); ok {
+    return dbErr.Kind
+  }
+  return KindUnknown
+}
+
+// IsUniqueViolation reports whether err was caused by a unique
+// or primary key constraint.
+func IsUniqueViolation(err error) bool {
+  return kindOf(err) == KindUniqueViolation
+}
+
+// IsForeignKeyViolation reports whether err was caused by a foreign
+// key constraint.
+func IsForeignKeyViolation(err error) bool {
+  return kindOf(err) == KindForeignKeyViolation
+}
+
+// IsNotNullViolation reports whether err was caused by writing NULL
+// into a NOT NULL column.
+func IsNotNullViolation(err error) bool {
+  return kindOf(err) == KindNotNullViolation
+}
+
+// IsDeadlock reports whether the transaction was aborted because of
+// a deadlock.
+func IsDeadlock(err error) bool {
+  return kindOf(err) == KindDeadlock
+}
+
+// IsSerializationFailure reports whether the transaction could not be
+// serialized and should be retried. mysql has no such error: InnoDB
+// reports the conflicts as deadlocks (1213), see IsDeadlock. A lock
+// wait timeout (1205) is neither, as mysql rolls back only the
+// statement, not the transaction.
+func IsSerializationFailure(err error) bool {
+  return kindOf(err) == KindSerializationFailure
+}
+
+var (
+  mysqlDupKeyRe   = regexp.MustCompile("for key '([^']*)'")
+  mysqlFkRe       = regexp.MustCompile("\\(`[^`]*`\\.`([^`]*)`, CONSTRAINT `([^`]*)` FOREIGN KEY \\(`([^`]*)`\\)")
+  mysqlColumnRe   = regexp.MustCompile("(?:Column|Field) '([^']*)'")
+  sqlite3ColumnRe = regexp.MustCompile("constraint failed: ([^ ,]+)")
+)
+
+func fromMysql(err mysqlError) *DBError {
+  e := &DBError{
+    Driver:  "mysql",
+    Code:    fmt.Sprint(err.number),
+    Message: err.message,
+    Err:     err.err,
+  }
+
+  switch err.number {
+  case 1062, 1169, 1586: // ER_DUP_ENTRY, ER_DUP_UNIQUE, ER_DUP_ENTRY_WITH_KEY_NAME
+    e.Kind = KindUniqueViolation
+    if m := mysqlDupKeyRe.FindStringSubmatch(err.message); m != nil {
+      // MySQL 8 reports the key as "table.key"
+      if i := strings.LastIndex(m[1], "."); i >= 0 {
+        e.Table, e.Constraint = m[1][:i], m[1][i+1:]
+      } else {
+        e.Constraint = m[1]
+      }
+    }
+  case 1216, 1217, 1451, 1452: // ER_NO_REFERENCED_ROW, ER_ROW_IS_REFERENCED(_2)
+    e.Kind = KindForeignKeyViolation
+    if m := mysqlFkRe.FindStringSubmatch(err.message); m != nil {
+      e.Table, e.Constraint, e.Column = m[1], m[2], m[3]
+    }
+  case 1048, 1364: // ER_BAD_NULL_ERROR, ER_NO_DEFAULT_FOR_FIELD
+    e.Kind = KindNotNullViolation
+    if m := mysqlColumnRe.FindStringSubmatch(err.message); m != nil {
+      e.Column = m[1]
+    }
+  case 1213: // ER_LOCK_DEADLOCK
+    e.Kind = KindDeadlock
+  }
+
+  return e
+}
+
+func fromPostgresql(err pgError) *DBError {
+  e := &DBError{
+    Driver:     "postgresql",
+    Code:       err.Get('C'),
+    Message:    err.Get('M'),
+    Constraint: err.Get('n'),
+    Table:      err.Get('t'),
+    Column:     err.Get('c'),
+    Err:        err,
+  }
+
+  switch e.Code {
+  case "23505": // unique_violation
+    e.Kind = KindUniqueViolation
+  case "23503": // foreign_key_violation
+    e.Kind = KindForeignKeyViolation
+  case "23502": // not_null_violation
+    e.Kind = KindNotNullViolation
+  case "40P01": // deadlock_detected
+    e.Kind = KindDeadlock
+  case "40001": // serialization_failure
+    e.Kind = KindSerializationFailure
+  }
+
+  return e
+}
+
+func fromSqlite3(err sqlite3Error) *DBError {
+  e := &DBError{
+    Driver:  "sqlite3",
+    Code:    fmt.Sprint(err.extendedCode),
+    Message: err.err.Error(),
+    Err:     err.err,
+  }
+
+  switch err.extendedCode {
+  case sqlite3ConstraintUnique, sqlite3ConstraintPrimaryKey:
+    e.Kind = KindUniqueViolation
+  case sqlite3ConstraintForeignKey:
+    e.Kind = KindForeignKeyViolation
+  case sqlite3ConstraintNotNull:
+    e.Kind = KindNotNullViolation
+  case sqlite3BusySnapshot:
+    e.Kind = KindSerializationFailure
+  }
+
+  // e.g. "UNIQUE constraint failed: users.email, users.name"
+  if m := sqlite3ColumnRe.FindStringSubmatch(e.Message); m != nil {
+    if i := strings.Index(m[1], "."); i >= 0 {
+      e.Table, e.Column = m[1][:i], m[1][i+1:]
+    }
+  }
+
+  return e
+}
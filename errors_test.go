@@ -0,0 +1,59 @@
+package kdb
+
+import (
+  "database/sql"
+  "fmt"
+  mysql "github.com/Go-SQL-Driver/MySQL"
+  _ "github.com/mattn/go-sqlite3"
+  "testing"
+)
+
+func TestSqlite3Errors(t *testing.T) {
+  db, err := sql.Open("sqlite3", ":memory:")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer db.Close()
+
+  _, err = db.Exec("create table users (id integer not null primary key, email text not null unique)")
+  if err != nil {
+    t.Fatal(err)
+  }
+  _, err = db.Exec("insert into users (id, email) values (1, 'a@b.c')")
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  _, err = db.Exec("insert into users (id, email) values (2, 'a@b.c')")
+  if !IsUniqueViolation(fmt.Errorf("wrapped: %w", err)) {
+    t.Fatalf("expected unique violation, got %v", err)
+  }
+  dbErr, ok := AsDBError(err)
+  if !ok || dbErr.Table != "users" || dbErr.Column != "email" {
+    t.Fatalf("unexpected DBError: %+v", dbErr)
+  }
+
+  _, err = db.Exec("insert into users (id, email) values (3, null)")
+  if !IsNotNullViolation(err) || IsUniqueViolation(err) {
+    t.Fatalf("expected not null violation, got %v", err)
+  }
+
+  if IsDeadlock(nil) || IsUniqueViolation(sql.ErrNoRows) {
+    t.Fatal("non driver errors should not be classified")
+  }
+}
+
+func TestMysqlErrors(t *testing.T) {
+  err := fmt.Errorf("wrapped: %w", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'a@b.c' for key 'users.email'"})
+  dbErr, ok := AsDBError(err)
+  if !ok || dbErr.Kind != KindUniqueViolation || dbErr.Table != "users" || dbErr.Constraint != "email" || dbErr.Code != "1062" {
+    t.Fatalf("unexpected DBError: %+v", dbErr)
+  }
+
+  if !IsDeadlock(&mysql.MySQLError{Number: 1213}) || IsSerializationFailure(&mysql.MySQLError{Number: 1213}) {
+    t.Error("expected 1213 to be a deadlock only")
+  }
+  if _, ok := AsDBError(&mysql.MySQLError{Number: 1205}); !ok || kindOf(&mysql.MySQLError{Number: 1205}) != KindUnknown {
+    t.Error("expected 1205 to be a mysql error of no kind")
+  }
+}
@@ -0,0 +1,317 @@
+package kdb
+
+import (
+  "context"
+  "database/sql"
+  "log/slog"
+  "sort"
+  "sync"
+  "time"
+)
+
+// QueryEvent describes a single query or statement executed
+// through a kdb handle.
+type QueryEvent struct {
+  Op    string // "exec", "query" or "queryrow"
+  SQL   string
+  Args  []interface{}
+  Start time.Time
+
+  // set before AfterQuery is called. For "query" events run by the
+  // kdb helpers (QueryMaps, QueryOne, QueryColumn, ...) AfterQuery is
+  // called once the rows are read and closed, so Duration includes
+  // reading them and Err is rows.Err. When QueryContext is called
+  // directly it is called once QueryContext returns, as the *sql.Rows
+  // it returns can not be wrapped.
+  Duration     time.Duration
+  RowsAffected int64 // -1 when unknown (e.g. for queries)
+  Err          error
+}
+
+// Hook is called around every query run through a kdb handle.
+// BeforeQuery may return a derived context (e.g. carrying a trace
+// span) which is used for the query and passed to AfterQuery.
+type Hook interface {
+  BeforeQuery(ctx context.Context, e *QueryEvent) context.Context
+  AfterQuery(ctx context.Context, e *QueryEvent)
+}
+
+func before(ctx context.Context, hooks []Hook, op, query string, args []interface{}) (context.Context, *QueryEvent) {
+  e := &QueryEvent{
+    Op:           op,
+    SQL:          query,
+    Args:         args,
+    Start:        time.Now(),
+    RowsAffected: -1,
+  }
+  for _, h := range hooks {
+    ctx = h.BeforeQuery(ctx, e)
+  }
+  return ctx, e
+}
+
+func after(ctx context.Context, hooks []Hook, e *QueryEvent, err error) {
+  e.Duration = time.Since(e.Start)
+  e.Err = err
+  for _, h := range hooks {
+    h.AfterQuery(ctx, e)
+  }
+}
+
+func runExec(ctx context.Context, hooks []Hook, query string, args []interface{}, fn func(context.Context) (sql.Result, error)) (sql.Result, error) {
+  if len(hooks) == 0 {
+    return fn(ctx)
+  }
+
+  ctx, e := before(ctx, hooks, "exec", query, args)
+  res, err := fn(ctx)
+  if err == nil {
+    if n, err := res.RowsAffected(); err == nil {
+      e.RowsAffected = n
+    }
+  }
+  after(ctx, hooks, e, err)
+  return res, err
+}
+
+func runQuery(ctx context.Context, hooks []Hook, query string, args []interface{}, fn func(context.Context) (*sql.Rows, error)) (*sql.Rows, error) {
+  if len(hooks) == 0 {
+    return fn(ctx)
+  }
+
+  ctx, e := before(ctx, hooks, "query", query, args)
+  rows, err := fn(ctx)
+  after(ctx, hooks, e, err)
+  return rows, err
+}
+
+// runRows is runQuery for the kdb helpers. The hooks are called by the
+// returned function, which closes the rows once they have been read.
+func runRows(ctx context.Context, hooks []Hook, query string, args []interface{}, fn func(context.Context) (*sql.Rows, error)) (*sql.Rows, func() error, error) {
+  if len(hooks) == 0 {
+    rows, err := fn(ctx)
+    if err != nil {
+      return nil, nil, err
+    }
+    return rows, rows.Close, nil
+  }
+
+  ctx, e := before(ctx, hooks, "query", query, args)
+  rows, err := fn(ctx)
+  if err != nil {
+    after(ctx, hooks, e, err)
+    return nil, nil, err
+  }
+
+  return rows, func() error {
+    err := rows.Close()
+    after(ctx, hooks, e, rows.Err())
+    return err
+  }, nil
+}
+
+func runQueryRow(ctx context.Context, hooks []Hook, query string, args []interface{}, fn func(context.Context) *sql.Row) *sql.Row {
+  if len(hooks) == 0 {
+    return fn(ctx)
+  }
+
+  ctx, e := before(ctx, hooks, "queryrow", query, args)
+  row := fn(ctx)
+  after(ctx, hooks, e, row.Err())
+  return row
+}
+
+// Redactor rewrites query arguments before they are logged.
+type Redactor func(args []interface{}) []interface{}
+
+// RedactAll replaces every argument with "?".
+func RedactAll(args []interface{}) []interface{} {
+  redacted := make([]interface{}, len(args))
+  for i := range redacted {
+    redacted[i] = "?"
+  }
+  return redacted
+}
+
+// LogHook logs every query to a slog.Logger. Failed queries are
+// logged at slog.LevelError.
+type LogHook struct {
+  Logger *slog.Logger
+  Level  slog.Level
+  Redact Redactor // when nil, arguments are logged as is
+}
+
+// NewLogHook returns a LogHook logging at slog.LevelDebug with all
+// arguments redacted.
+func NewLogHook(logger *slog.Logger) *LogHook {
+  return &LogHook{Logger: logger, Level: slog.LevelDebug, Redact: RedactAll}
+}
+
+func (h *LogHook) BeforeQuery(ctx context.Context, e *QueryEvent) context.Context {
+  return ctx
+}
+
+func (h *LogHook) AfterQuery(ctx context.Context, e *QueryEvent) {
+  level := h.Level
+  if e.Err != nil {
+    level = slog.LevelError
+  }
+  logEvent(ctx, h.Logger, level, "query", e, h.Redact)
+}
+
+// SlowQueryHook logs queries that take at least Threshold, see
+// QueryEvent.Duration for what is timed.
+type SlowQueryHook struct {
+  Logger    *slog.Logger
+  Threshold time.Duration
+  Redact    Redactor // when nil, arguments are logged as is
+}
+
+// NewSlowQueryHook returns a SlowQueryHook logging at slog.LevelWarn
+// with all arguments redacted.
+func NewSlowQueryHook(logger *slog.Logger, threshold time.Duration) *SlowQueryHook {
+  return &SlowQueryHook{Logger: logger, Threshold: threshold, Redact: RedactAll}
+}
+
+func (h *SlowQueryHook) BeforeQuery(ctx context.Context, e *QueryEvent) context.Context {
+  return ctx
+}
+
+func (h *SlowQueryHook) AfterQuery(ctx context.Context, e *QueryEvent) {
+  if e.Duration >= h.Threshold {
+    logEvent(ctx, h.Logger, slog.LevelWarn, "slow query", e, h.Redact)
+  }
+}
+
+func logEvent(ctx context.Context, logger *slog.Logger, level slog.Level, msg string, e *QueryEvent, redact Redactor) {
+  if logger == nil {
+    logger = slog.Default()
+  }
+  if !logger.Enabled(ctx, level) {
+    return
+  }
+
+  args := e.Args
+  if redact != nil {
+    args = redact(args)
+  }
+
+  attrs := []slog.Attr{
+    slog.String("op", e.Op),
+    slog.String("sql", e.SQL),
+    slog.Any("args", args),
+    slog.Duration("duration", e.Duration),
+  }
+  if e.RowsAffected >= 0 {
+    attrs = append(attrs, slog.Int64("rows_affected", e.RowsAffected))
+  }
+  if e.Err != nil {
+    attrs = append(attrs, slog.String("error", e.Err.Error()))
+  }
+  logger.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// DefaultBuckets are the latency histogram bounds used by NewMetrics
+// when none are given.
+var DefaultBuckets = []time.Duration{
+  time.Millisecond,
+  5 * time.Millisecond,
+  10 * time.Millisecond,
+  50 * time.Millisecond,
+  100 * time.Millisecond,
+  500 * time.Millisecond,
+  time.Second,
+  5 * time.Second,
+}
+
+// StatementStats holds the metrics collected for one SQL statement.
+type StatementStats struct {
+  SQL    string
+  Count  int64
+  Errors int64
+  Total  time.Duration
+  Max    time.Duration
+
+  // Counts[i] is the number of executions that took at most
+  // Buckets[i]; the last element counts everything slower.
+  Buckets []time.Duration
+  Counts  []int64
+}
+
+// Mean returns the average latency of the statement.
+func (s StatementStats) Mean() time.Duration {
+  if s.Count == 0 {
+    return 0
+  }
+  return s.Total / time.Duration(s.Count)
+}
+
+// Metrics is a hook collecting per statement counts and latency
+// histograms in process, see QueryEvent.Duration for what is timed.
+type Metrics struct {
+  buckets []time.Duration
+
+  mu    sync.Mutex
+  stats map[string]*StatementStats
+}
+
+// NewMetrics returns a Metrics hook using the given (ascending)
+// histogram buckets, or DefaultBuckets if none are given.
+func NewMetrics(buckets ...time.Duration) *Metrics {
+  if len(buckets) == 0 {
+    buckets = DefaultBuckets
+  }
+  return &Metrics{buckets: buckets, stats: make(map[string]*StatementStats)}
+}
+
+func (m *Metrics) BeforeQuery(ctx context.Context, e *QueryEvent) context.Context {
+  return ctx
+}
+
+func (m *Metrics) AfterQuery(ctx context.Context, e *QueryEvent) {
+  m.mu.Lock()
+  defer m.mu.Unlock()
+
+  s, ok := m.stats[e.SQL]
+  if !ok {
+    s = &StatementStats{
+      SQL:     e.SQL,
+      Buckets: m.buckets,
+      Counts:  make([]int64, len(m.buckets)+1),
+    }
+    m.stats[e.SQL] = s
+  }
+
+  s.Count++
+  if e.Err != nil {
+    s.Errors++
+  }
+  s.Total += e.Duration
+  if e.Duration > s.Max {
+    s.Max = e.Duration
+  }
+  s.Counts[sort.Search(len(m.buckets), func(i int) bool { return e.Duration <= m.buckets[i] })]++
+}
+
+// Snapshot returns a copy of the collected metrics sorted by SQL.
+func (m *Metrics) Snapshot() []StatementStats {
+  m.mu.Lock()
+  defer m.mu.Unlock()
+
+  snapshot := make([]StatementStats, 0, len(m.stats))
+  for _, s := range m.stats {
+    c := *s
+    c.Counts = append([]int64(nil), s.Counts...)
+    snapshot = append(snapshot, c)
+  }
+  sort.Slice(snapshot, func(i, j int) bool { return snapshot[i].SQL < snapshot[j].SQL })
+
+  return snapshot
+}
+
+// Reset discards all collected metrics.
+func (m *Metrics) Reset() {
+  m.mu.Lock()
+  defer m.mu.Unlock()
+  m.stats = make(map[string]*StatementStats)
+}
@@ -0,0 +1,105 @@
+package kdb
+
+import (
+  "bytes"
+  "database/sql"
+  "github.com/mattn/go-sqlite3"
+  "log/slog"
+  "strings"
+  "testing"
+  "time"
+)
+
+func init() {
+  // sleep(ms) makes reading every row slow
+  sql.Register("sqlite3_sleep", &sqlite3.SQLiteDriver{
+    ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+      return conn.RegisterFunc("sleep", func(ms int64) int64 {
+        time.Sleep(time.Duration(ms) * time.Millisecond)
+        return ms
+      }, false)
+    },
+  })
+}
+
+func TestHooks(t *testing.T) {
+  db, err := Open("sqlite3", ":memory:")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer db.Close()
+
+  var buf bytes.Buffer
+  metrics := NewMetrics()
+  db.AddHook(NewLogHook(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))), metrics)
+
+  if _, err = db.Exec("create table foo (id integer, secret text)"); err != nil {
+    t.Fatal(err)
+  }
+  for i := 0; i < 3; i++ {
+    if _, err = db.Exec("INSERT INTO foo (id, secret) VALUES (?, ?)", i, "hunter2"); err != nil {
+      t.Fatal(err)
+    }
+  }
+  if _, err = QueryMaps(db, "select * from foo"); err != nil {
+    t.Fatal(err)
+  }
+  db.Exec("select * from missing")
+
+  if strings.Contains(buf.String(), "hunter2") {
+    t.Fatal("arguments were not redacted")
+  }
+  if !strings.Contains(buf.String(), "rows_affected=1") {
+    t.Fatalf("rows affected not logged:\n%s", buf.String())
+  }
+
+  stats := metrics.Snapshot()
+  if len(stats) != 4 {
+    t.Fatalf("expected 4 statements, got %d", len(stats))
+  }
+  for _, s := range stats {
+    switch {
+    case strings.HasPrefix(s.SQL, "INSERT"):
+      if s.Count != 3 {
+        t.Fatalf("expected 3 inserts, got %d", s.Count)
+      }
+    case strings.Contains(s.SQL, "missing"):
+      if s.Errors != 1 {
+        t.Fatalf("expected 1 error, got %d", s.Errors)
+      }
+    }
+  }
+}
+
+func TestHooksReadRows(t *testing.T) {
+  db, err := Open("sqlite3_sleep", ":memory:")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer db.Close()
+
+  metrics := NewMetrics()
+  db.AddHook(metrics)
+
+  query := "select sleep(20) from (select 1 union all select 2 union all select 3)"
+  if _, err = QueryColumn[int64](db, query); err != nil {
+    t.Fatal(err)
+  }
+  tx, err := db.Begin()
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer tx.Rollback()
+  if _, err = QueryMaps(tx, query); err != nil {
+    t.Fatal(err)
+  }
+
+  stats := metrics.Snapshot()
+  if len(stats) != 1 || stats[0].Count != 2 {
+    t.Fatalf("expected the query twice, got %+v", stats)
+  }
+  // every row is read in at least 20ms
+  if stats[0].Total < 120*time.Millisecond {
+    t.Errorf("expected reading the rows to be timed, got %v", stats[0].Total)
+  }
+}
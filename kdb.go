@@ -2,10 +2,12 @@ package kdb
 
 import (
   "database/sql"
+  "errors"
   "fmt"
   // "github.com/kisielk/sqlstruct"
   // "reflect"
   "reflect"
+  "sort"
   "strings"
 )
 
@@ -13,6 +15,15 @@ type Arger interface {
   Args() []interface{}
 }
 
+var (
+  // ErrNotFound is returned by the strict single row helpers when
+  // the query returns no rows. It wraps sql.ErrNoRows.
+  ErrNotFound = fmt.Errorf("kdb: no rows found: %w", sql.ErrNoRows)
+  // ErrTooManyRows is returned by the strict single row helpers when
+  // the query returns more than one row.
+  ErrTooManyRows = errors.New("kdb: query returned more than one row")
+)
+
 func GetMaps(rows *sql.Rows) ([]map[string]interface{}, error) {
   var maps []map[string]interface{}
 
@@ -42,11 +53,12 @@ func GetMaps(rows *sql.Rows) ([]map[string]interface{}, error) {
   return maps, nil
 }
 
-func QueryMap(db *sql.DB, query string, args ...interface{}) (map[string]interface{}, error) {
-  rows, err := db.Query(query, args...)
+func QueryMap(db Querier, query string, args ...interface{}) (map[string]interface{}, error) {
+  rows, done, err := queryRows(db, query, args)
   if err != nil {
     return nil, err
   }
+  defer done()
 
   ret, err := GetMaps(rows)
   if len(ret) > 0 {
@@ -56,11 +68,12 @@ func QueryMap(db *sql.DB, query string, args ...interface{}) (map[string]interfa
   return nil, err
 }
 
-func QueryMaps(db *sql.DB, query string, args ...interface{}) ([]map[string]interface{}, error) {
-  rows, err := db.Query(query, args...)
+func QueryMaps(db Querier, query string, args ...interface{}) ([]map[string]interface{}, error) {
+  rows, done, err := queryRows(db, query, args)
   if err != nil {
     return nil, err
   }
+  defer done()
 
   ret, err := GetMaps(rows)
   if len(ret) > 0 {
@@ -74,11 +87,12 @@ func QueryMaps(db *sql.DB, query string, args ...interface{}) ([]map[string]inte
 // Usage:
 //  var account Accounts // implements Arger
 //  found, err := QueryArger(db, `select * from Accounts where username = ?`, &account, "kevin")
-func QueryArger(db *sql.DB, query string, arger Arger, args ...interface{}) (found bool, err error) {
-  rows, err := db.Query(query, args...)
+func QueryArger(db Querier, query string, arger Arger, args ...interface{}) (found bool, err error) {
+  rows, done, err := queryRows(db, query, args)
   if err != nil {
     return false, err
   }
+  defer done()
 
   if rows.Next() {
     found = true
@@ -91,16 +105,91 @@ func QueryArger(db *sql.DB, query string, arger Arger, args ...interface{}) (fou
   return found, nil
 }
 
+// Querys the database for exactly one row, and sets the data in arger.
+// Unlike QueryArger, it returns ErrNotFound if there are no rows and
+// ErrTooManyRows if there is more than one.
+// Usage:
+//  var account Accounts // implements Arger
+//  err := QueryOne(db, `select * from Accounts where username = ?`, &account, "kevin")
+func QueryOne(db Querier, query string, arger Arger, args ...interface{}) error {
+  rows, done, err := queryRows(db, query, args)
+  if err != nil {
+    return err
+  }
+  defer done()
+
+  if !rows.Next() {
+    if err := rows.Err(); err != nil {
+      return err
+    }
+    return ErrNotFound
+  }
+
+  err = rows.Scan(arger.Args()...)
+  if err != nil {
+    return err
+  }
+
+  if rows.Next() {
+    return ErrTooManyRows
+  }
+
+  return rows.Err()
+}
+
+// QueryOneMap is the strict version of QueryMap. It returns
+// ErrNotFound if there are no rows and ErrTooManyRows if there
+// is more than one.
+func QueryOneMap(db Querier, query string, args ...interface{}) (map[string]interface{}, error) {
+  rows, done, err := queryRows(db, query, args)
+  if err != nil {
+    return nil, err
+  }
+  defer done()
+
+  cols, err := rows.Columns()
+  if err != nil {
+    return nil, err
+  }
+
+  if !rows.Next() {
+    if err := rows.Err(); err != nil {
+      return nil, err
+    }
+    return nil, ErrNotFound
+  }
+
+  values, err := scanRaw(rows, len(cols))
+  if err != nil {
+    return nil, err
+  }
+
+  if rows.Next() {
+    return nil, ErrTooManyRows
+  }
+  if err := rows.Err(); err != nil {
+    return nil, err
+  }
+
+  m := make(map[string]interface{})
+  for n, c := range cols {
+    m[strings.ToLower(c)] = values[n]
+  }
+
+  return m, nil
+}
+
 // Queries database for many rows, and sets the strcts interface as
 // the returned rows.
 // Usage:
 //  var strcts []Accounts // Each Accounts implements Arger
 //  err := helper.QueryArgers(db, `select * from Accounts`, &strcts, reflect.TypeOf(Accounts{}))
-func QueryArgers(db *sql.DB, query string, strcts interface{}, typ reflect.Type, args ...interface{}) error {
-  rows, err := db.Query(query, args...)
+func QueryArgers(db Querier, query string, strcts interface{}, typ reflect.Type, args ...interface{}) error {
+  rows, done, err := queryRows(db, query, args)
   if err != nil {
     return err
   }
+  defer done()
 
   vof := reflect.ValueOf(strcts)
 
@@ -166,14 +255,20 @@ func Fields(names []string) string {
   return `("` + strings.Join(names, `", "`) + `")`
 }
 
-func InsertMap(db *sql.DB, table string, m map[string]interface{}) (sql.Result, error) {
+func InsertMap(db Querier, table string, m map[string]interface{}) (sql.Result, error) {
   var fields []string
   var values []interface{}
   var variables []string
 
-  for key, value := range m {
+  // sort the keys so the same map always produces the same
+  // statement, which keeps it cacheable.
+  for key := range m {
     fields = append(fields, key)
-    values = append(values, value)
+  }
+  sort.Strings(fields)
+
+  for _, key := range fields {
+    values = append(values, m[key])
     variables = append(variables, "?")
   }
 
@@ -0,0 +1,116 @@
+package kdb
+
+import (
+  "database/sql"
+  "errors"
+  "testing"
+)
+
+type account struct {
+  Id   int64
+  Name string
+}
+
+func (t *account) Args() []interface{} { return []interface{}{&t.Id, &t.Name} }
+
+func openTestDB(t *testing.T) *DB {
+  db, err := Open("sqlite3", ":memory:")
+  if err != nil {
+    t.Fatal(err)
+  }
+  db.SetMaxOpenConns(1)
+
+  sqls := []string{
+    "create table accounts (id integer not null primary key, name text not null)",
+    "insert into accounts (id, name) values (1, 'kevin'), (2, 'bob'), (3, 'bob')",
+  }
+  for _, sql := range sqls {
+    if _, err = db.Exec(sql); err != nil {
+      t.Fatal(err)
+    }
+  }
+
+  return db
+}
+
+func TestQueryOne(t *testing.T) {
+  db := openTestDB(t)
+  defer db.Close()
+
+  var a account
+  if err := QueryOne(db, "select id, name from accounts where name = ?", &a, "kevin"); err != nil || a.Id != 1 {
+    t.Fatalf("expected kevin, got %+v (%v)", a, err)
+  }
+
+  err := QueryOne(db, "select id, name from accounts where name = ?", &a, "nobody")
+  if !errors.Is(err, ErrNotFound) || !errors.Is(err, sql.ErrNoRows) {
+    t.Fatalf("expected ErrNotFound, got %v", err)
+  }
+
+  if err = QueryOne(db, "select id, name from accounts where name = ?", &a, "bob"); err != ErrTooManyRows {
+    t.Fatalf("expected ErrTooManyRows, got %v", err)
+  }
+
+  if _, err = QueryOneMap(db, "select * from accounts"); err != ErrTooManyRows {
+    t.Fatalf("expected ErrTooManyRows, got %v", err)
+  }
+  m, err := QueryOneMap(db, "select * from accounts where id = ?", 2)
+  if err != nil || m["name"] == nil {
+    t.Fatalf("unexpected result %v (%v)", m, err)
+  }
+  if _, err = QueryOneMap(db, "select * from accounts where id = ?", 4); err != ErrNotFound {
+    t.Fatalf("expected ErrNotFound, got %v", err)
+  }
+
+  // errors reading the rows are returned, on the first row or after it
+  for _, query := range []string{
+    "select abs(-9223372036854775808)",
+    "select abs(column1) from (values (1), (-9223372036854775808))",
+  } {
+    if _, err = QueryOneMap(db, query); err == nil || err == ErrNotFound || err == ErrTooManyRows {
+      t.Fatalf("%s: expected an overflow, got %v", query, err)
+    }
+  }
+}
+
+func TestScalars(t *testing.T) {
+  db := openTestDB(t)
+  defer db.Close()
+
+  n, err := QueryCount(db, "select count(*) from accounts where name = ?", "bob")
+  if err != nil || n != 2 {
+    t.Fatalf("expected 2, got %d (%v)", n, err)
+  }
+
+  name, err := QueryScalar[string](db, "select name from accounts where id = ?", 1)
+  if err != nil || name != "kevin" {
+    t.Fatalf("expected kevin, got %q (%v)", name, err)
+  }
+  if _, err = QueryScalar[string](db, "select name from accounts where id = ?", 4); err != ErrNotFound {
+    t.Fatalf("expected ErrNotFound, got %v", err)
+  }
+
+  ids, err := QueryColumn[int](db, "select id from accounts order by id")
+  if err != nil || len(ids) != 3 || ids[2] != 3 {
+    t.Fatalf("unexpected ids %v (%v)", ids, err)
+  }
+
+  exists, err := QueryExists(db, "select 1 from accounts where name = ?", "nobody")
+  if err != nil || exists {
+    t.Fatalf("expected no rows, got %v (%v)", exists, err)
+  }
+
+  names, err := QueryKeyed[int64, string](db, "select id, name from accounts")
+  if err != nil || names[2] != "bob" {
+    t.Fatalf("unexpected names %v (%v)", names, err)
+  }
+
+  accounts, err := QueryKeyed[string, account](db, "select name, id, name from accounts where id = 1")
+  if err == nil {
+    t.Fatal("expected an error for mismatched columns")
+  }
+  accounts, err = QueryKeyed[string, account](db, "select id, name from accounts")
+  if err != nil || accounts["1"].Name != "kevin" {
+    t.Fatalf("unexpected accounts %v (%v)", accounts, err)
+  }
+}
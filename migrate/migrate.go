@@ -0,0 +1,619 @@
+// Package migrate applies versioned schema migrations, written in SQL
+// or Go, to a database and records them in a table of it.
+//
+// SQL migrations are files named <version>_<name>.up.sql, with an
+// optional <version>_<name>.down.sql undoing it; <version>_<name>.sql
+// is an up migration without a down one. The version is a number, by
+// convention the UTC time the migration was created at, as kdb migrate
+// new names them, e.g. 20240102150405_add_users.up.sql. A file starting
+// with the line "-- kdb:no-transaction" is run outside of a
+// transaction, e.g. for CREATE INDEX CONCURRENTLY; the up and down
+// files of a migration are marked on their own.
+//
+// Each migration runs in a transaction, together with its record in
+// the migrations table, where the database has transactional DDL
+// (postgresql and sqlite3, not mysql). Up and Down hold a lock while
+// they run, GET_LOCK on mysql and an advisory lock on postgresql, so
+// concurrent deploys apply every migration once; sqlite3 has no such
+// lock and relies on its own locking of the file.
+// Usage:
+//  //go:embed migrations
+//  var migrations embed.FS
+//
+//  m := migrate.New(db, "postgresql")
+//  err := m.Load(migrations, "migrations")
+//  ...
+//  err = m.Register(&migrate.Migration{Version: 20240102150405, Name: "backfill", Up: backfill})
+//  ...
+//  applied, err := m.Up(ctx)
+package migrate
+
+import (
+  "bytes"
+  "context"
+  "crypto/sha256"
+  "database/sql"
+  "encoding/hex"
+  "errors"
+  "fmt"
+  "github.com/kdar/kdb"
+  "hash/fnv"
+  "io/fs"
+  "os"
+  "path"
+  "path/filepath"
+  "sort"
+  "strconv"
+  "strings"
+  "time"
+)
+
+// Func is a step of a Go migration. It runs in the transaction of the
+// migration when there is one.
+type Func func(ctx context.Context, q kdb.Querier) error
+
+// Migration is one version of the schema: SQL (UpSQL and DownSQL) or
+// Go (Up and Down). The down step is optional.
+type Migration struct {
+  Version int64
+  Name    string
+
+  UpSQL, DownSQL string
+  Up, Down       Func
+
+  // run the up or down step outside of a transaction
+  UpNoTransaction, DownNoTransaction bool
+}
+
+func (mig *Migration) String() string {
+  if mig.Name == "" {
+    return strconv.FormatInt(mig.Version, 10)
+  }
+  return fmt.Sprintf("%d_%s", mig.Version, mig.Name)
+}
+
+// the checksum of the up step recorded when the migration is applied,
+// empty for Go migrations
+func (mig *Migration) checksum() string {
+  if mig.Up != nil {
+    return ""
+  }
+  sum := sha256.Sum256([]byte(mig.UpSQL))
+  return hex.EncodeToString(sum[:])
+}
+
+// Status is the state of a migration, as returned by Status.
+type Status struct {
+  Version   int64
+  Name      string
+  Applied   bool
+  AppliedAt time.Time
+
+  Changed bool // applied, but its SQL has changed since
+  Missing bool // applied, but not among the migrations
+}
+
+// Migrator applies the migrations loaded or registered on it.
+type Migrator struct {
+  // Table is the table, optionally schema qualified, applied
+  // migrations are recorded in. It is created when missing.
+  Table string
+
+  db         *sql.DB
+  dialect    string
+  migrations map[int64]*Migration
+}
+
+// New returns a Migrator of db, whose dialect is mysql, postgresql or
+// sqlite3, recording migrations in schema_migrations.
+func New(db *sql.DB, dialect string) *Migrator {
+  return &Migrator{
+    Table:      "schema_migrations",
+    db:         db,
+    dialect:    dialect,
+    migrations: make(map[int64]*Migration),
+  }
+}
+
+// Register adds migrations, usually Go ones.
+func (m *Migrator) Register(migrations ...*Migration) error {
+  for _, mig := range migrations {
+    switch {
+    case mig.Version <= 0:
+      return fmt.Errorf("migrate: %s: the version must be positive", mig)
+    case mig.Up == nil && strings.TrimSpace(mig.UpSQL) == "":
+      return fmt.Errorf("migrate: %s: no up step", mig)
+    case mig.Up != nil && mig.UpSQL != "" || mig.Down != nil && mig.DownSQL != "":
+      return fmt.Errorf("migrate: %s: both SQL and Go steps", mig)
+    case m.migrations[mig.Version] != nil:
+      return fmt.Errorf("migrate: %s: version %d is also %s", mig, mig.Version, m.migrations[mig.Version])
+    }
+    m.migrations[mig.Version] = mig
+  }
+  return nil
+}
+
+// Load adds the SQL migrations in dir of fsys, e.g. an embed.FS or
+// os.DirFS("."). Other files are ignored.
+func (m *Migrator) Load(fsys fs.FS, dir string) error {
+  entries, err := fs.ReadDir(fsys, dir)
+  if err != nil {
+    return err
+  }
+
+  loaded := make(map[int64]*Migration)
+  var versions []int64
+  for _, entry := range entries {
+    file := entry.Name()
+    if entry.IsDir() || !strings.HasSuffix(file, ".sql") {
+      continue
+    }
+
+    base, down := strings.TrimSuffix(file, ".sql"), false
+    switch {
+    case strings.HasSuffix(base, ".down"):
+      base, down = strings.TrimSuffix(base, ".down"), true
+    case strings.HasSuffix(base, ".up"):
+      base = strings.TrimSuffix(base, ".up")
+    }
+    version, name, ok := parseName(base)
+    if !ok {
+      return fmt.Errorf("migrate: %s: expected <version>_<name>.up.sql or .down.sql", file)
+    }
+
+    b, err := fs.ReadFile(fsys, path.Join(dir, file))
+    if err != nil {
+      return err
+    }
+
+    mig := loaded[version]
+    if mig == nil {
+      mig = &Migration{Version: version, Name: name}
+      loaded[version] = mig
+      versions = append(versions, version)
+    }
+    switch {
+    case mig.Name != name:
+      return fmt.Errorf("migrate: %s: version %d is also %s", file, version, mig)
+    case down && mig.DownSQL != "" || !down && mig.UpSQL != "":
+      return fmt.Errorf("migrate: %s: %s has two files for the same step", file, mig)
+    case down:
+      mig.DownSQL = string(b)
+      mig.DownNoTransaction = noTransaction(b)
+    default:
+      mig.UpSQL = string(b)
+      mig.UpNoTransaction = noTransaction(b)
+    }
+  }
+
+  for _, version := range versions {
+    err = m.Register(loaded[version])
+    if err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+// parse a file name, less its extensions, as <version>_<name>
+func parseName(base string) (int64, string, bool) {
+  digits, name, _ := strings.Cut(base, "_")
+  version, err := strconv.ParseInt(digits, 10, 64)
+  return version, name, err == nil && version > 0
+}
+
+// report whether a migration file asks to run outside of a transaction
+func noTransaction(b []byte) bool {
+  line, _, _ := bytes.Cut(b, []byte("\n"))
+  return strings.TrimSpace(string(line)) == "-- kdb:no-transaction"
+}
+
+// the migrations by version
+func (m *Migrator) sorted() []*Migration {
+  var migrations []*Migration
+  for _, mig := range m.migrations {
+    migrations = append(migrations, mig)
+  }
+  sort.Slice(migrations, func(i, j int) bool {
+    return migrations[i].Version < migrations[j].Version
+  })
+  return migrations
+}
+
+// Up applies the migrations not applied yet, in version order, and
+// returns them. This includes migrations older than the latest applied
+// one, e.g. ones merged from another branch. It fails, applying
+// nothing, when the SQL of an applied migration has changed since.
+func (m *Migrator) Up(ctx context.Context) ([]*Migration, error) {
+  var applied []*Migration
+  err := m.locked(ctx, func(conn *sql.Conn) error {
+    records, err := m.records(ctx, conn)
+    if err != nil {
+      return err
+    }
+    for _, r := range records {
+      if mig := m.migrations[r.version]; mig != nil && r.checksum != mig.checksum() {
+        return fmt.Errorf("migrate: %s has changed since it was applied", mig)
+      }
+    }
+
+    for _, mig := range m.sorted() {
+      if _, ok := records[mig.Version]; ok {
+        continue
+      }
+      err = m.run(ctx, conn, mig, true)
+      if err != nil {
+        return err
+      }
+      applied = append(applied, mig)
+    }
+    return nil
+  })
+  return applied, err
+}
+
+// Down rolls back the latest n applied migrations, latest first, and
+// returns them. Each must be among the migrations with a down step.
+func (m *Migrator) Down(ctx context.Context, n int) ([]*Migration, error) {
+  var rolledBack []*Migration
+  err := m.locked(ctx, func(conn *sql.Conn) error {
+    records, err := m.records(ctx, conn)
+    if err != nil {
+      return err
+    }
+    var versions []int64
+    for version := range records {
+      versions = append(versions, version)
+    }
+    sort.Slice(versions, func(i, j int) bool {
+      return versions[i] > versions[j]
+    })
+
+    for _, version := range versions {
+      if len(rolledBack) == n {
+        break
+      }
+      mig := m.migrations[version]
+      switch {
+      case mig == nil:
+        return fmt.Errorf("migrate: %d_%s is applied but not among the migrations", version, records[version].name)
+      case mig.Down == nil && strings.TrimSpace(mig.DownSQL) == "":
+        return fmt.Errorf("migrate: %s has no down step", mig)
+      }
+      err = m.run(ctx, conn, mig, false)
+      if err != nil {
+        return err
+      }
+      rolledBack = append(rolledBack, mig)
+    }
+    return nil
+  })
+  return rolledBack, err
+}
+
+// Status returns the state of every migration and of those applied but
+// no longer among them, by version.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+  err := m.checkDialect()
+  if err != nil {
+    return nil, err
+  }
+  conn, err := m.db.Conn(ctx)
+  if err != nil {
+    return nil, err
+  }
+  defer conn.Close()
+
+  err = m.createTable(ctx, conn)
+  if err != nil {
+    return nil, err
+  }
+  records, err := m.records(ctx, conn)
+  if err != nil {
+    return nil, err
+  }
+
+  var statuses []Status
+  for _, mig := range m.sorted() {
+    s := Status{Version: mig.Version, Name: mig.Name}
+    if r, ok := records[mig.Version]; ok {
+      s.Applied, s.AppliedAt, s.Changed = true, r.appliedAt, r.checksum != mig.checksum()
+    }
+    statuses = append(statuses, s)
+  }
+  for version, r := range records {
+    if m.migrations[version] == nil {
+      statuses = append(statuses, Status{Version: version, Name: r.name, Applied: true, AppliedAt: r.appliedAt, Missing: true})
+    }
+  }
+  sort.Slice(statuses, func(i, j int) bool {
+    return statuses[i].Version < statuses[j].Version
+  })
+  return statuses, nil
+}
+
+// a row of the migrations table
+type record struct {
+  version   int64
+  name      string
+  checksum  string
+  appliedAt time.Time
+}
+
+// quote an identifier for the dialect
+func (m *Migrator) quote(name string) string {
+  if m.dialect == "mysql" {
+    return "`" + strings.Replace(name, "`", "``", -1) + "`"
+  }
+  return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// the quoted migrations table
+func (m *Migrator) table() string {
+  if schema, table, ok := strings.Cut(m.Table, "."); ok {
+    return m.quote(schema) + "." + m.quote(table)
+  }
+  return m.quote(m.Table)
+}
+
+// return the n'th (1 based) placeholder for the dialect
+func (m *Migrator) placeholder(n int) string {
+  if m.dialect == "postgresql" {
+    return fmt.Sprintf("$%d", n)
+  }
+  return "?"
+}
+
+// create the migrations table if it is missing. applied_at is stored as
+// RFC 3339 text, as not every driver scans times by default.
+func (m *Migrator) createTable(ctx context.Context, conn *sql.Conn) error {
+  _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+m.table()+` (
+      version BIGINT NOT NULL PRIMARY KEY,
+      name VARCHAR(255) NOT NULL,
+      checksum VARCHAR(64) NOT NULL,
+      applied_at VARCHAR(40) NOT NULL
+    )`)
+  return err
+}
+
+// read the migrations table by version
+func (m *Migrator) records(ctx context.Context, conn *sql.Conn) (map[int64]record, error) {
+  rows, err := conn.QueryContext(ctx, `SELECT version, name, checksum, applied_at FROM `+m.table())
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  records := make(map[int64]record)
+  for rows.Next() {
+    var r record
+    var appliedAt string
+    err = rows.Scan(&r.version, &r.name, &r.checksum, &appliedAt)
+    if err != nil {
+      return nil, err
+    }
+    r.appliedAt, _ = time.Parse(time.RFC3339Nano, appliedAt)
+    records[r.version] = r
+  }
+  return records, rows.Err()
+}
+
+// the key of the postgresql advisory lock, from the migrations table
+func (m *Migrator) lockKey() int64 {
+  h := fnv.New64a()
+  h.Write([]byte("kdb/migrate:" + m.Table))
+  return int64(h.Sum64())
+}
+
+// the dialect is the db, not its database/sql driver name (e.g.
+// postgres), which would run without the lock of the db
+func (m *Migrator) checkDialect() error {
+  switch m.dialect {
+  case "mysql", "postgresql", "sqlite3":
+    return nil
+  }
+  return fmt.Errorf("migrate: unknown dialect %q, expected mysql, postgresql or sqlite3", m.dialect)
+}
+
+// run fn on a connection holding the lock of the migrations table,
+// which exists by then
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn) error) error {
+  err := m.checkDialect()
+  if err != nil {
+    return err
+  }
+  conn, err := m.db.Conn(ctx)
+  if err != nil {
+    return err
+  }
+  defer conn.Close()
+
+  switch m.dialect {
+  case "mysql":
+    // mysql lock names are at most 64 characters
+    name := "kdb/migrate:" + m.Table
+    if len(name) > 64 {
+      name = name[:64]
+    }
+    var ok sql.NullInt64
+    err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, -1)", name).Scan(&ok)
+    if err == nil && ok.Int64 != 1 {
+      err = errors.New("migrate: could not take the migration lock")
+    }
+    if err != nil {
+      return err
+    }
+    defer func() {
+      conn.QueryRowContext(context.Background(), "SELECT RELEASE_LOCK(?)", name).Scan(&ok)
+    }()
+  case "postgresql":
+    _, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", m.lockKey())
+    if err != nil {
+      return err
+    }
+    defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", m.lockKey())
+  }
+
+  err = m.createTable(ctx, conn)
+  if err != nil {
+    return err
+  }
+  return fn(conn)
+}
+
+// querier is a kdb.Querier of a *sql.Conn, to run migrations outside of
+// a transaction on the connection holding the lock
+type querier struct {
+  *sql.Conn
+}
+
+func (q querier) Exec(query string, args ...interface{}) (sql.Result, error) {
+  return q.ExecContext(context.Background(), query, args...)
+}
+
+func (q querier) Query(query string, args ...interface{}) (*sql.Rows, error) {
+  return q.QueryContext(context.Background(), query, args...)
+}
+
+// apply (up) or roll back a migration and record it, in a transaction
+// where the dialect has transactional DDL
+func (m *Migrator) run(ctx context.Context, conn *sql.Conn, mig *Migration, up bool) error {
+  noTransaction := mig.UpNoTransaction
+  if !up {
+    noTransaction = mig.DownNoTransaction
+  }
+
+  var q kdb.Querier = querier{conn}
+  var tx *sql.Tx
+  if m.dialect != "mysql" && !noTransaction {
+    var err error
+    tx, err = conn.BeginTx(ctx, nil)
+    if err != nil {
+      return err
+    }
+    defer tx.Rollback()
+    q = tx
+  }
+
+  var err error
+  switch {
+  case up && mig.Up != nil:
+    err = mig.Up(ctx, q)
+  case up:
+    err = m.exec(ctx, q, mig.UpSQL)
+  case mig.Down != nil:
+    err = mig.Down(ctx, q)
+  default:
+    err = m.exec(ctx, q, mig.DownSQL)
+  }
+  if err != nil {
+    return fmt.Errorf("migrate: %s: %w", mig, err)
+  }
+
+  if up {
+    _, err = q.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (version, name, checksum, applied_at) VALUES (%s, %s, %s, %s)",
+      m.table(), m.placeholder(1), m.placeholder(2), m.placeholder(3), m.placeholder(4)),
+      mig.Version, mig.Name, mig.checksum(), time.Now().UTC().Format(time.RFC3339Nano))
+  } else {
+    _, err = q.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE version = %s", m.table(), m.placeholder(1)), mig.Version)
+  }
+  if err != nil {
+    return fmt.Errorf("migrate: %s: %w", mig, err)
+  }
+
+  if tx != nil {
+    return tx.Commit()
+  }
+  return nil
+}
+
+// execute the SQL of a migration. The mysql driver runs one statement
+// at a time unless multiStatements is set, so for mysql it is split.
+func (m *Migrator) exec(ctx context.Context, q kdb.Querier, src string) error {
+  stmts := []string{src}
+  if m.dialect == "mysql" {
+    stmts = splitStatements(src)
+  }
+  for _, stmt := range stmts {
+    if strings.TrimSpace(stmt) == "" {
+      continue
+    }
+    _, err := q.ExecContext(ctx, stmt)
+    if err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+// split SQL at the semicolons outside of quotes and comments
+func splitStatements(src string) []string {
+  var stmts []string
+  start := 0
+  for i := 0; i < len(src); i++ {
+    switch c := src[i]; {
+    case c == '\'' || c == '"' || c == '`':
+      for i++; i < len(src) && src[i] != c; i++ {
+        if src[i] == '\\' {
+          i++
+        }
+      }
+    case c == '-' && strings.HasPrefix(src[i:], "--") || c == '#':
+      for i < len(src) && src[i] != '\n' {
+        i++
+      }
+    case c == '/' && strings.HasPrefix(src[i:], "/*"):
+      end := strings.Index(src[i+2:], "*/")
+      if end < 0 {
+        i = len(src)
+      } else {
+        i += end + 3
+      }
+    case c == ';':
+      stmts = append(stmts, src[start:i])
+      start = i + 1
+    }
+  }
+  return append(stmts, src[start:])
+}
+
+// CreateFiles writes empty up and down migration files named after the
+// current UTC time and name in dir, creating it if needed, and returns
+// their paths.
+func CreateFiles(dir, name string) (up, down string, err error) {
+  // names are lowercase words joined by underscores
+  var b strings.Builder
+  for _, word := range strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+    return !('a' <= r && r <= 'z' || '0' <= r && r <= '9')
+  }) {
+    if b.Len() > 0 {
+      b.WriteByte('_')
+    }
+    b.WriteString(word)
+  }
+  if b.Len() == 0 {
+    return "", "", fmt.Errorf("migrate: bad migration name %q", name)
+  }
+
+  err = os.MkdirAll(dir, 0755)
+  if err != nil {
+    return "", "", err
+  }
+
+  base := filepath.Join(dir, time.Now().UTC().Format("20060102150405")+"_"+b.String())
+  up, down = base+".up.sql", base+".down.sql"
+  for _, file := range []struct{ path, step string }{{up, "applying"}, {down, "rolling back"}} {
+    f, err := os.OpenFile(file.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+    if err != nil {
+      return "", "", err
+    }
+    _, err = fmt.Fprintf(f, "-- the SQL %s %s\n", file.step, b.String())
+    if cerr := f.Close(); err == nil {
+      err = cerr
+    }
+    if err != nil {
+      return "", "", err
+    }
+  }
+  return up, down, nil
+}
@@ -0,0 +1,307 @@
+package migrate
+
+import (
+  "context"
+  "database/sql"
+  "database/sql/driver"
+  "github.com/kdar/kdb"
+  _ "github.com/mattn/go-sqlite3"
+  "io"
+  "os"
+  "reflect"
+  "strings"
+  "sync"
+  "testing"
+  "testing/fstest"
+)
+
+func TestSplitStatements(t *testing.T) {
+  stmts := splitStatements("create table a (x text default ';'); -- b; c\n# d;\ninsert into a values (\"e;\\\"\"), (`f;`) /* g; */;")
+  expect := []string{"create table a (x text default ';')", " -- b; c\n# d;\ninsert into a values (\"e;\\\"\"), (`f;`) /* g; */", ""}
+  if !reflect.DeepEqual(stmts, expect) {
+    t.Errorf("expected %q, got %q", expect, stmts)
+  }
+}
+
+func TestMigrate(t *testing.T) {
+  ctx := context.Background()
+  db, err := sql.Open("sqlite3", ":memory:")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer db.Close()
+  db.SetMaxOpenConns(1)
+
+  fsys := fstest.MapFS{
+    "migrations/1_users.up.sql":   {Data: []byte("create table users (id integer primary key, email text);")},
+    "migrations/1_users.down.sql": {Data: []byte("drop table users;")},
+    "migrations/2_orders.sql":     {Data: []byte("create table orders (id integer primary key, user_id integer);")},
+    "migrations/README":           {Data: []byte("not a migration")},
+  }
+  m := New(db, "sqlite3")
+  err = m.Load(fsys, "migrations")
+  if err != nil {
+    t.Fatal(err)
+  }
+  err = m.Register(&Migration{Version: 3, Name: "admin",
+    Up: func(ctx context.Context, q kdb.Querier) error {
+      _, err := q.ExecContext(ctx, "insert into users (email) values ('admin@example.com')")
+      return err
+    },
+    Down: func(ctx context.Context, q kdb.Querier) error {
+      _, err := q.ExecContext(ctx, "delete from users")
+      return err
+    },
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+  if err := m.Register(&Migration{Version: 3, UpSQL: "select 1"}); err == nil {
+    t.Error("expected an error for a duplicate version")
+  }
+
+  applied, err := m.Up(ctx)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(applied) != 3 || applied[0].String() != "1_users" || applied[2].String() != "3_admin" {
+    t.Errorf("unexpected applied migrations %v", applied)
+  }
+  if applied, err := m.Up(ctx); err != nil || len(applied) != 0 {
+    t.Errorf("expected nothing to apply, got %v, %v", applied, err)
+  }
+
+  var count int
+  db.QueryRow("select count(*) from users").Scan(&count)
+  if count != 1 {
+    t.Errorf("expected the admin user, got %d users", count)
+  }
+
+  // 2_orders has no down step
+  rolledBack, err := m.Down(ctx, 1)
+  if err != nil || len(rolledBack) != 1 || rolledBack[0].Version != 3 {
+    t.Errorf("expected 3_admin rolled back, got %v, %v", rolledBack, err)
+  }
+  if _, err := m.Down(ctx, 1); err == nil || !strings.Contains(err.Error(), "2_orders has no down step") {
+    t.Errorf("expected no down step, got %v", err)
+  }
+
+  // 3_admin is applied again, but a failing migration is rolled back
+  // with its record
+  m.Register(&Migration{Version: 4, Name: "bad", UpSQL: "create table tags (id integer); insert into nowhere values (1);"})
+  if _, err := m.Up(ctx); err == nil || !strings.Contains(err.Error(), "4_bad") {
+    t.Errorf("expected 4_bad to fail, got %v", err)
+  }
+  if err := db.QueryRow("select count(*) from tags").Scan(&count); err == nil {
+    t.Error("expected the tags table to be rolled back")
+  }
+  delete(m.migrations, 4)
+
+  // a changed migration, and ones no longer known
+  fsys["migrations/1_users.up.sql"] = &fstest.MapFile{Data: []byte("create table users (id integer primary key);")}
+  m2 := New(db, "sqlite3")
+  err = m2.Load(fsys, "migrations")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if _, err := m2.Up(ctx); err == nil || !strings.Contains(err.Error(), "1_users has changed") {
+    t.Errorf("expected 1_users to have changed, got %v", err)
+  }
+
+  db.Exec("insert into schema_migrations values (9, 'gone', '', '2024-01-02T15:04:05Z')")
+  statuses, err := m2.Status(ctx)
+  if err != nil {
+    t.Fatal(err)
+  }
+  var got []string
+  for _, s := range statuses {
+    if s.AppliedAt.IsZero() {
+      t.Errorf("%s: expected the time it was applied", s.Name)
+    }
+    got = append(got, strings.TrimSpace(strings.Join([]string{s.Name, map[bool]string{true: "applied"}[s.Applied],
+      map[bool]string{true: "changed"}[s.Changed], map[bool]string{true: "missing"}[s.Missing]}, " ")))
+  }
+  expect := []string{"users applied changed", "orders applied", "admin applied  missing", "gone applied  missing"}
+  if !reflect.DeepEqual(got, expect) {
+    t.Errorf("expected %q, got %q", expect, got)
+  }
+}
+
+func TestLoad(t *testing.T) {
+  for _, fsys := range []fstest.MapFS{
+    {"m/users.sql": {Data: []byte("select 1")}},
+    {"m/1_users.down.sql": {Data: []byte("select 1")}},
+    {"m/1_users.sql": {Data: []byte("select 1")}, "m/1_accounts.sql": {Data: []byte("select 1")}},
+    {"m/1_users.sql": {Data: []byte("select 1")}, "m/1_users.up.sql": {Data: []byte("select 1")}},
+  } {
+    if err := New(nil, "sqlite3").Load(fsys, "m"); err == nil {
+      t.Errorf("expected an error for %v", fsys)
+    }
+  }
+
+  // the up and down steps are marked on their own
+  m := New(nil, "postgresql")
+  err := m.Load(fstest.MapFS{
+    "m/5_index.up.sql":  {Data: []byte("-- kdb:no-transaction\ncreate index concurrently i on t (c);")},
+    "m/6_drop.up.sql":   {Data: []byte("drop index i;")},
+    "m/6_drop.down.sql": {Data: []byte("-- kdb:no-transaction\ncreate index concurrently i on t (c);")},
+  }, "m")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if mig := m.migrations[5]; !mig.UpNoTransaction || mig.DownNoTransaction {
+    t.Error("expected 5_index to run up outside of a transaction")
+  }
+  if mig := m.migrations[6]; mig.UpNoTransaction || !mig.DownNoTransaction {
+    t.Error("expected 6_drop to run down outside of a transaction")
+  }
+}
+
+func TestCreateFiles(t *testing.T) {
+  dir := t.TempDir() + "/migrations"
+  up, down, err := CreateFiles(dir, "Add users & orders")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if !strings.HasSuffix(up, "_add_users_orders.up.sql") || !strings.HasSuffix(down, "_add_users_orders.down.sql") {
+    t.Errorf("unexpected files %s and %s", up, down)
+  }
+
+  m := New(nil, "sqlite3")
+  err = m.Load(os.DirFS(dir), ".")
+  if err != nil || len(m.migrations) != 1 {
+    t.Errorf("expected the new migration to load, got %v", err)
+  }
+  if _, _, err := CreateFiles(dir, "!"); err == nil {
+    t.Error("expected an error for a bad name")
+  }
+}
+
+// fakeDriver is a database/sql driver recording the statements run on
+// it, to test the dialects without their databases. Queries return no
+// rows, but for the mysql locks, which return 1.
+type fakeDriver struct {
+  mu    sync.Mutex
+  stmts []string
+}
+
+func (d *fakeDriver) record(query string) {
+  d.mu.Lock()
+  defer d.mu.Unlock()
+  d.stmts = append(d.stmts, strings.Join(strings.Fields(query), " "))
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) { return fakeConn{d}, nil }
+
+type fakeConn struct{ d *fakeDriver }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{c.d, query}, nil }
+func (c fakeConn) Close() error                              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error) {
+  c.d.record("BEGIN")
+  return fakeTx{c.d}, nil
+}
+
+type fakeTx struct{ d *fakeDriver }
+
+func (tx fakeTx) Commit() error   { tx.d.record("COMMIT"); return nil }
+func (tx fakeTx) Rollback() error { tx.d.record("ROLLBACK"); return nil }
+
+type fakeStmt struct {
+  d     *fakeDriver
+  query string
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+  s.d.record(s.query)
+  return driver.RowsAffected(0), nil
+}
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+  s.d.record(s.query)
+  return &fakeRows{lock: strings.Contains(s.query, "_LOCK(")}, nil
+}
+
+type fakeRows struct{ lock bool }
+
+func (r *fakeRows) Columns() []string { return []string{"result"} }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+  if !r.lock {
+    return io.EOF
+  }
+  r.lock = false
+  dest[0] = int64(1)
+  return nil
+}
+
+var fake = &fakeDriver{}
+
+func init() {
+  sql.Register("kdbtest-migrate", fake)
+}
+
+func TestDialects(t *testing.T) {
+  db, err := sql.Open("kdbtest-migrate", "")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer db.Close()
+
+  create := "CREATE TABLE IF NOT EXISTS %s ( version BIGINT NOT NULL PRIMARY KEY, name VARCHAR(255) NOT NULL, " +
+    "checksum VARCHAR(64) NOT NULL, applied_at VARCHAR(40) NOT NULL )"
+  tests := []struct {
+    dialect string
+    expect  []string
+  }{
+    // the second migration runs outside of a transaction
+    {"postgresql", []string{
+      "SELECT pg_advisory_lock($1)",
+      strings.Replace(create, "%s", `"schema_migrations"`, 1),
+      `SELECT version, name, checksum, applied_at FROM "schema_migrations"`,
+      "BEGIN",
+      "create table a (x int); create table b (y int);",
+      `INSERT INTO "schema_migrations" (version, name, checksum, applied_at) VALUES ($1, $2, $3, $4)`,
+      "COMMIT",
+      "create index concurrently a_x on a (x);",
+      `INSERT INTO "schema_migrations" (version, name, checksum, applied_at) VALUES ($1, $2, $3, $4)`,
+      "SELECT pg_advisory_unlock($1)",
+    }},
+    {"mysql", []string{
+      "SELECT GET_LOCK(?, -1)",
+      strings.Replace(create, "%s", "`schema_migrations`", 1),
+      "SELECT version, name, checksum, applied_at FROM `schema_migrations`",
+      "create table a (x int)",
+      "create table b (y int)",
+      "INSERT INTO `schema_migrations` (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)",
+      "create index concurrently a_x on a (x)",
+      "INSERT INTO `schema_migrations` (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)",
+      "SELECT RELEASE_LOCK(?)",
+    }},
+  }
+
+  for _, test := range tests {
+    fake.stmts = nil
+    m := New(db, test.dialect)
+    m.Register(&Migration{Version: 1, UpSQL: "create table a (x int); create table b (y int);"},
+      &Migration{Version: 2, UpSQL: "create index concurrently a_x on a (x);", UpNoTransaction: true})
+    _, err := m.Up(context.Background())
+    if err != nil {
+      t.Fatal(err)
+    }
+
+    if !reflect.DeepEqual(fake.stmts, test.expect) {
+      t.Errorf("%s: expected:\n%s\ngot:\n%s", test.dialect, strings.Join(test.expect, "\n"), strings.Join(fake.stmts, "\n"))
+    }
+  }
+
+  // the driver name is not a dialect
+  m := New(db, "postgres")
+  if _, err := m.Up(context.Background()); err == nil || !strings.Contains(err.Error(), "unknown dialect") {
+    t.Errorf("expected an unknown dialect, got %v", err)
+  }
+  if _, err := m.Status(context.Background()); err == nil {
+    t.Error("expected an unknown dialect")
+  }
+}
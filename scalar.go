@@ -0,0 +1,176 @@
+package kdb
+
+import (
+  "database/sql"
+  "fmt"
+)
+
+// scanRaw scans the current row into a slice of driver values.
+func scanRaw(rows *sql.Rows, n int) ([]interface{}, error) {
+  values := make([]interface{}, n)
+  scanArgs := make([]interface{}, n)
+  for x := range values {
+    scanArgs[x] = &values[x]
+  }
+  return values, rows.Scan(scanArgs...)
+}
+
+// QueryScalar queries for exactly one row and returns its first column
+// converted to T. It returns ErrNotFound if there are no rows and
+// ErrTooManyRows if there is more than one.
+// Usage:
+//  n, err := QueryScalar[int64](db, `select count(*) from Accounts`)
+func QueryScalar[T any](db Querier, query string, args ...interface{}) (T, error) {
+  var ret T
+
+  rows, done, err := queryRows(db, query, args)
+  if err != nil {
+    return ret, err
+  }
+  defer done()
+
+  cols, err := rows.Columns()
+  if err != nil {
+    return ret, err
+  }
+
+  if !rows.Next() {
+    if err := rows.Err(); err != nil {
+      return ret, err
+    }
+    return ret, ErrNotFound
+  }
+
+  values, err := scanRaw(rows, len(cols))
+  if err != nil {
+    return ret, err
+  }
+  err = ConvertAssign(&ret, values[0])
+  if err != nil {
+    return ret, err
+  }
+
+  if rows.Next() {
+    return ret, ErrTooManyRows
+  }
+
+  return ret, rows.Err()
+}
+
+// QueryCount is QueryScalar for count queries.
+// Usage:
+//  n, err := QueryCount(db, `select count(*) from Accounts where active = ?`, true)
+func QueryCount(db Querier, query string, args ...interface{}) (int64, error) {
+  return QueryScalar[int64](db, query, args...)
+}
+
+// QueryColumn returns the first column of every row converted to T.
+// Usage:
+//  ids, err := QueryColumn[int64](db, `select id from Accounts`)
+func QueryColumn[T any](db Querier, query string, args ...interface{}) ([]T, error) {
+  rows, done, err := queryRows(db, query, args)
+  if err != nil {
+    return nil, err
+  }
+  defer done()
+
+  cols, err := rows.Columns()
+  if err != nil {
+    return nil, err
+  }
+
+  var ret []T
+  for rows.Next() {
+    values, err := scanRaw(rows, len(cols))
+    if err != nil {
+      return nil, err
+    }
+
+    var v T
+    err = ConvertAssign(&v, values[0])
+    if err != nil {
+      return nil, err
+    }
+    ret = append(ret, v)
+  }
+
+  return ret, rows.Err()
+}
+
+// QueryExists reports whether the query returns at least one row.
+// Usage:
+//  exists, err := QueryExists(db, `select 1 from Accounts where username = ?`, "kevin")
+func QueryExists(db Querier, query string, args ...interface{}) (bool, error) {
+  rows, done, err := queryRows(db, query, args)
+  if err != nil {
+    return false, err
+  }
+  defer done()
+
+  if rows.Next() {
+    return true, nil
+  }
+
+  return false, rows.Err()
+}
+
+// QueryKeyed returns the rows of the query keyed by their first column
+// converted to K. If *V implements Arger the whole row (including the
+// first column) is converted into V's Args(); otherwise the query must
+// return two columns and the second one is converted to V. When
+// several rows share a key, the last one wins.
+// Usage:
+//  names, err := QueryKeyed[int64, string](db, `select id, name from Accounts`)
+//  accounts, err := QueryKeyed[int64, Accounts](db, `select * from Accounts`)
+func QueryKeyed[K comparable, V any](db Querier, query string, args ...interface{}) (map[K]V, error) {
+  rows, done, err := queryRows(db, query, args)
+  if err != nil {
+    return nil, err
+  }
+  defer done()
+
+  cols, err := rows.Columns()
+  if err != nil {
+    return nil, err
+  }
+
+  ret := make(map[K]V)
+  for rows.Next() {
+    values, err := scanRaw(rows, len(cols))
+    if err != nil {
+      return nil, err
+    }
+
+    var k K
+    err = ConvertAssign(&k, values[0])
+    if err != nil {
+      return nil, err
+    }
+
+    var v V
+    if arger, ok := interface{}(&v).(Arger); ok {
+      dests := arger.Args()
+      if len(dests) != len(values) {
+        return nil, fmt.Errorf("kdb: %T.Args() has %d destinations, query returned %d columns", v, len(dests), len(values))
+      }
+      for i, dest := range dests {
+        err = ConvertAssign(dest, values[i])
+        if err != nil {
+          return nil, fmt.Errorf("kdb: column %q: %v", cols[i], err)
+        }
+      }
+    } else {
+      if len(values) != 2 {
+        return nil, fmt.Errorf("kdb: QueryKeyed expected 2 columns, query returned %d", len(values))
+      }
+      err = ConvertAssign(&v, values[1])
+      if err != nil {
+        return nil, err
+      }
+    }
+
+    ret[k] = v
+  }
+
+  return ret, rows.Err()
+}
@@ -0,0 +1,228 @@
+package kdb
+
+import (
+  "context"
+  "fmt"
+  "regexp"
+  "strings"
+)
+
+// SchemaError is returned by VerifySchema when the database lacks
+// tables or columns the code expects, or has them with other types.
+type SchemaError struct {
+  Problems []string // e.g. "table users: column email is missing"
+}
+
+func (e *SchemaError) Error() string {
+  return "kdb: the database schema differs from the code:\n  " + strings.Join(e.Problems, "\n  ")
+}
+
+// a column of a schema fingerprint
+type columnSchema struct {
+  name     string
+  typ      string
+  nullable bool
+}
+
+// a table of a schema fingerprint
+type tableSchema struct {
+  schema  string // empty for the current one
+  name    string
+  columns []columnSchema
+}
+
+// the qualified name of the table, for messages
+func (t tableSchema) String() string {
+  if t.schema == "" {
+    return t.name
+  }
+  return t.schema + "." + t.name
+}
+
+// VerifySchema checks the database against the schema fingerprints
+// generated by kdb -verify, one per table: every table must exist with
+// every column, of the same type and nullability. Other tables and
+// columns are not checked. dialect is mysql, postgresql or sqlite3.
+// The differences are returned as a *SchemaError.
+//
+// A fingerprint is the table, optionally schema qualified, followed by
+// its columns in parentheses: each a name, a space and its type as the
+// database reports it ("" when it has none), with a "?" when nullable.
+// Names holding special characters are double quoted.
+// Usage:
+//  err := kdb.VerifySchema(ctx, db, "postgresql", `users(id bigint, email character varying(100)?)`)
+func VerifySchema(ctx context.Context, db Querier, dialect string, fingerprints ...string) error {
+  var query string
+  switch dialect {
+  case "mysql":
+    query = `SELECT column_name, column_type, is_nullable = 'YES'
+      FROM information_schema.columns
+      WHERE table_schema = COALESCE(NULLIF(?, ''), DATABASE()) AND table_name = ?`
+  case "postgresql":
+    query = `SELECT a.attname, format_type(a.atttypid, a.atttypmod), NOT a.attnotnull
+      FROM pg_attribute a
+      JOIN pg_class c ON c.oid = a.attrelid
+      JOIN pg_namespace n ON n.oid = c.relnamespace
+      WHERE n.nspname = coalesce(nullif($1, ''), current_schema()) AND c.relname = $2
+        AND a.attnum > 0 AND NOT a.attisdropped`
+  case "sqlite3":
+    // primary key columns are never null, whatever was declared
+    query = `SELECT name, type, "notnull" = 0 AND pk = 0 FROM pragma_table_info(?2)
+      WHERE ?1 = '' OR ?1 = 'main'`
+  default:
+    return fmt.Errorf("kdb: unknown dialect %q", dialect)
+  }
+
+  var problems []string
+  for _, fp := range fingerprints {
+    want, err := parseFingerprint(fp)
+    if err != nil {
+      return err
+    }
+
+    rows, err := db.QueryContext(ctx, query, want.schema, want.name)
+    if err != nil {
+      return err
+    }
+    have := make(map[string]columnSchema)
+    for rows.Next() {
+      var col columnSchema
+      err = rows.Scan(&col.name, &col.typ, &col.nullable)
+      if err != nil {
+        rows.Close()
+        return err
+      }
+      have[col.name] = col
+    }
+    err = rows.Err()
+    rows.Close()
+    if err != nil {
+      return err
+    }
+
+    if len(have) == 0 {
+      problems = append(problems, fmt.Sprintf("table %s is missing", want))
+      continue
+    }
+    for _, col := range want.columns {
+      got, ok := have[col.name]
+      switch {
+      case !ok:
+        problems = append(problems, fmt.Sprintf("table %s: column %s is missing", want, col.name))
+      case normalizeType(got.typ) != normalizeType(col.typ):
+        problems = append(problems, fmt.Sprintf("table %s: column %s is %s, expected %s", want, col.name, got.typ, col.typ))
+      case got.nullable && !col.nullable:
+        problems = append(problems, fmt.Sprintf("table %s: column %s is nullable, expected NOT NULL", want, col.name))
+      case !got.nullable && col.nullable:
+        problems = append(problems, fmt.Sprintf("table %s: column %s is NOT NULL, expected nullable", want, col.name))
+      }
+    }
+  }
+
+  if len(problems) > 0 {
+    return &SchemaError{Problems: problems}
+  }
+  return nil
+}
+
+// mysql integer display widths, e.g. the (11) of int(11), which mysql
+// 8 no longer reports
+var displayWidth = regexp.MustCompile(`^(tinyint|smallint|mediumint|int|bigint)\(\d+\)`)
+
+// return a type in the form types are compared in
+func normalizeType(typ string) string {
+  typ = strings.Join(strings.Fields(strings.ToLower(typ)), " ")
+  return displayWidth.ReplaceAllString(typ, "$1")
+}
+
+// parse a schema fingerprint, see VerifySchema
+func parseFingerprint(s string) (tableSchema, error) {
+  var t tableSchema
+  bad := func() (tableSchema, error) {
+    return t, fmt.Errorf("kdb: bad schema fingerprint %q", s)
+  }
+
+  name, rest, ok := fingerprintName(s)
+  if !ok {
+    return bad()
+  }
+  t.name = name
+  if strings.HasPrefix(rest, ".") {
+    t.schema = t.name
+    t.name, rest, ok = fingerprintName(rest[1:])
+    if !ok {
+      return bad()
+    }
+  }
+  if !strings.HasPrefix(rest, "(") || !strings.HasSuffix(rest, ")") {
+    return bad()
+  }
+  rest = rest[1 : len(rest)-1]
+
+  for rest != "" {
+    var col columnSchema
+    col.name, rest, ok = fingerprintName(rest)
+    if !ok || !strings.HasPrefix(rest, " ") {
+      return bad()
+    }
+    rest = rest[1:]
+
+    // the type ends at a comma outside parentheses and quotes
+    end, depth, quoted := len(rest), 0, false
+    for i := 0; i < len(rest) && end == len(rest); i++ {
+      switch c := rest[i]; {
+      case c == '\'':
+        quoted = !quoted
+      case quoted:
+      case c == '(':
+        depth++
+      case c == ')':
+        depth--
+      case c == ',' && depth == 0:
+        end = i
+      }
+    }
+    col.typ = rest[:end]
+    if strings.HasSuffix(col.typ, "?") {
+      col.typ, col.nullable = col.typ[:len(col.typ)-1], true
+    }
+    switch col.typ {
+    case "":
+      return bad()
+    case `""`:
+      col.typ = ""
+    }
+    t.columns = append(t.columns, col)
+
+    rest = strings.TrimPrefix(rest[end:], ",")
+    rest = strings.TrimPrefix(rest, " ")
+  }
+
+  return t, nil
+}
+
+// read a name, double quoted or up to the next special character, and
+// return it and the rest of s
+func fingerprintName(s string) (name, rest string, ok bool) {
+  if !strings.HasPrefix(s, `"`) {
+    i := strings.IndexAny(s, ` .(),?"`)
+    if i < 0 {
+      i = len(s)
+    }
+    return s[:i], s[i:], i > 0
+  }
+
+  var b strings.Builder
+  for i := 1; i < len(s); i++ {
+    if s[i] == '"' {
+      if i+1 < len(s) && s[i+1] == '"' {
+        b.WriteByte('"')
+        i++
+        continue
+      }
+      return b.String(), s[i+1:], true
+    }
+    b.WriteByte(s[i])
+  }
+  return "", s, false
+}
@@ -0,0 +1,80 @@
+package kdb
+
+import (
+  "context"
+  "database/sql"
+  "errors"
+  "strings"
+  "testing"
+)
+
+func TestParseFingerprint(t *testing.T) {
+  table, err := parseFingerprint(`sales."order items"(id int, "a ""b""" decimal(10,2)?, kind enum('x,y','z'))`)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if table.schema != "sales" || table.name != "order items" || len(table.columns) != 3 {
+    t.Fatalf("unexpected table %+v", table)
+  }
+  expect := []columnSchema{{"id", "int", false}, {`a "b"`, "decimal(10,2)", true}, {"kind", "enum('x,y','z')", false}}
+  for i, col := range expect {
+    if table.columns[i] != col {
+      t.Errorf("expected %+v, got %+v", col, table.columns[i])
+    }
+  }
+
+  table, err = parseFingerprint(`t(a "", b ""?)`)
+  if err != nil || len(table.columns) != 2 || table.columns[0] != (columnSchema{"a", "", false}) || table.columns[1] != (columnSchema{"b", "", true}) {
+    t.Errorf("expected columns without a type, got %+v (%v)", table, err)
+  }
+
+  for _, bad := range []string{"users", "users(id)", `"users(id int)`, "(id int)", "users(id ?)"} {
+    if _, err := parseFingerprint(bad); err == nil {
+      t.Errorf("expected an error for %q", bad)
+    }
+  }
+}
+
+func TestVerifySchema(t *testing.T) {
+  db, err := sql.Open("sqlite3", ":memory:")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer db.Close()
+  db.SetMaxOpenConns(1)
+
+  _, err = db.Exec("create table users (id integer primary key, email varchar(100) not null, name text, age int)")
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  ctx := context.Background()
+  err = VerifySchema(ctx, db, "sqlite3", "users(id INTEGER, email VARCHAR(100), name text?)")
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  err = VerifySchema(ctx, db, "sqlite3",
+    "users(id integer, email text, name text, age int?, created datetime)",
+    "orders(id integer)")
+  var schemaErr *SchemaError
+  if !errors.As(err, &schemaErr) {
+    t.Fatalf("expected a *SchemaError, got %v", err)
+  }
+  expect := []string{
+    "table users: column email is varchar(100), expected text",
+    "table users: column name is nullable, expected NOT NULL",
+    "table users: column created is missing",
+    "table orders is missing",
+  }
+  if strings.Join(schemaErr.Problems, "\n") != strings.Join(expect, "\n") {
+    t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(expect, "\n"), strings.Join(schemaErr.Problems, "\n"))
+  }
+
+  if normalizeType("INT(11) unsigned") != "int unsigned" || normalizeType("tinyint(1)") != "tinyint" {
+    t.Error("expected mysql display widths to be ignored")
+  }
+  if err := VerifySchema(ctx, db, "oracle"); err == nil {
+    t.Error("expected an error for an unknown dialect")
+  }
+}
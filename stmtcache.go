@@ -0,0 +1,175 @@
+package kdb
+
+import (
+  "container/list"
+  "context"
+  "database/sql"
+  "database/sql/driver"
+  "errors"
+  "strings"
+  "sync"
+)
+
+// stmtCache is an LRU cache of prepared statements keyed by their
+// SQL text.
+type stmtCache struct {
+  db   *sql.DB
+  size int
+
+  mu    sync.Mutex
+  ll    *list.List
+  items map[string]*list.Element
+}
+
+type cachedStmt struct {
+  query string
+  stmt  *sql.Stmt
+}
+
+func newStmtCache(db *sql.DB, size int) *stmtCache {
+  return &stmtCache{
+    db:    db,
+    size:  size,
+    ll:    list.New(),
+    items: make(map[string]*list.Element),
+  }
+}
+
+// lookup returns the cached statement for query, or nil if it is not
+// cached.
+func (c *stmtCache) lookup(query string) *sql.Stmt {
+  c.mu.Lock()
+  defer c.mu.Unlock()
+
+  if e, ok := c.items[query]; ok {
+    c.ll.MoveToFront(e)
+    return e.Value.(*cachedStmt).stmt
+  }
+  return nil
+}
+
+// get returns the cached statement for query, preparing it if needed.
+func (c *stmtCache) get(ctx context.Context, query string) (*sql.Stmt, error) {
+  if stmt := c.lookup(query); stmt != nil {
+    return stmt, nil
+  }
+
+  // prepare without holding the lock so a slow prepare doesn't
+  // block every other query.
+  stmt, err := c.db.PrepareContext(ctx, query)
+  if err != nil {
+    return nil, err
+  }
+
+  c.mu.Lock()
+  defer c.mu.Unlock()
+
+  if e, ok := c.items[query]; ok {
+    // someone else prepared it in the meantime
+    stmt.Close()
+    c.ll.MoveToFront(e)
+    return e.Value.(*cachedStmt).stmt, nil
+  }
+
+  c.items[query] = c.ll.PushFront(&cachedStmt{query, stmt})
+  for c.ll.Len() > c.size {
+    c.remove(c.ll.Back())
+  }
+
+  return stmt, nil
+}
+
+// evict removes stmt from the cache if it is still the statement
+// cached for query.
+func (c *stmtCache) evict(query string, stmt *sql.Stmt) {
+  c.mu.Lock()
+  defer c.mu.Unlock()
+
+  if e, ok := c.items[query]; ok && e.Value.(*cachedStmt).stmt == stmt {
+    c.remove(e)
+  }
+}
+
+func (c *stmtCache) remove(e *list.Element) {
+  cs := c.ll.Remove(e).(*cachedStmt)
+  delete(c.items, cs.query)
+  // database/sql keeps the statement alive until any open rows
+  // using it are closed.
+  cs.stmt.Close()
+}
+
+func (c *stmtCache) close() error {
+  c.mu.Lock()
+  defer c.mu.Unlock()
+
+  var err error
+  for c.ll.Len() > 0 {
+    cs := c.ll.Remove(c.ll.Back()).(*cachedStmt)
+    delete(c.items, cs.query)
+    if cerr := cs.stmt.Close(); cerr != nil && err == nil {
+      err = cerr
+    }
+  }
+
+  return err
+}
+
+// withStmt runs fn with the cached statement for query, bound to tx
+// when tx is not nil (see Tx.bind). If the statement is no longer
+// usable it is prepared again and fn is retried once.
+func withStmt[T any](ctx context.Context, c *stmtCache, tx *Tx, query string, fn func(*sql.Stmt) (T, error)) (T, error) {
+  var res T
+  var err error
+
+  for attempt := 0; attempt < 2; attempt++ {
+    var stmt, s *sql.Stmt
+    if tx != nil {
+      stmt = c.lookup(query)
+      s, err = tx.bind(ctx, query, stmt)
+    } else {
+      stmt, err = c.get(ctx, query)
+      s = stmt
+    }
+    if err != nil {
+      return res, err
+    }
+
+    res, err = fn(s)
+    if !needsReprepare(err) {
+      return res, err
+    }
+
+    if stmt != nil {
+      c.evict(query, stmt)
+    }
+    if tx != nil {
+      tx.unbind(query)
+    }
+  }
+
+  return res, err
+}
+
+// needsReprepare reports whether err means the prepared statement
+// (or the connection it was prepared on) can no longer be used.
+func needsReprepare(err error) bool {
+  if err == nil {
+    return false
+  }
+  if errors.Is(err, driver.ErrBadConn) {
+    return true
+  }
+  // database/sql doesn't export this one
+  if err.Error() == "sql: statement is closed" {
+    return true
+  }
+  if dbErr, ok := AsDBError(err); ok {
+    switch dbErr.Driver {
+    case "mysql":
+      return dbErr.Code == "1615" // ER_NEED_REPREPARE
+    case "postgresql":
+      return dbErr.Code == "0A000" && strings.Contains(dbErr.Message, "cached plan")
+    }
+  }
+  return false
+}
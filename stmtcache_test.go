@@ -0,0 +1,103 @@
+package kdb
+
+import (
+  "context"
+  "testing"
+  "time"
+)
+
+func TestStmtCache(t *testing.T) {
+  db, err := Open("sqlite3", ":memory:")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer db.Close()
+  db.SetMaxOpenConns(1)
+  db.SetStmtCacheSize(2)
+
+  if _, err = db.Exec("create table foo (id integer, name text)"); err != nil {
+    t.Fatal(err)
+  }
+  for i := 0; i < 3; i++ {
+    if _, err = InsertMap(db, "foo", map[string]interface{}{"id": i, "name": "x"}); err != nil {
+      t.Fatal(err)
+    }
+  }
+  if db.stmts.ll.Len() != 2 {
+    t.Fatalf("expected 2 cached statements, got %d", db.stmts.ll.Len())
+  }
+
+  // a statement closed behind our back is prepared again
+  const count = "select count(*) from foo"
+  stmt, err := db.stmts.get(context.Background(), count)
+  if err != nil {
+    t.Fatal(err)
+  }
+  stmt.Close()
+
+  var n int
+  if err = db.QueryRow(count).Scan(&n); err != nil || n != 3 {
+    t.Fatalf("expected 3 rows, got %d (%v)", n, err)
+  }
+
+  tx, err := db.Begin()
+  if err != nil {
+    t.Fatal(err)
+  }
+  if _, err = InsertMap(tx, "foo", map[string]interface{}{"id": 3, "name": "y"}); err != nil {
+    t.Fatal(err)
+  }
+  if err = tx.QueryRow(count).Scan(&n); err != nil || n != 4 {
+    t.Fatalf("expected 4 rows in tx, got %d (%v)", n, err)
+  }
+  if err = tx.Rollback(); err != nil {
+    t.Fatal(err)
+  }
+
+  if err = db.QueryRow(count).Scan(&n); err != nil || n != 3 {
+    t.Fatalf("expected 3 rows after rollback, got %d (%v)", n, err)
+  }
+}
+
+func TestStmtCacheTx(t *testing.T) {
+  db, err := Open("sqlite3", ":memory:")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer db.Close()
+  db.SetMaxOpenConns(1)
+  db.SetStmtCacheSize(10)
+
+  // the transaction holds the only connection, so its statements
+  // must be prepared on it
+  ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+  defer cancel()
+  tx, err := db.BeginTx(ctx, nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer tx.Rollback()
+
+  if _, err = tx.ExecContext(ctx, "create table bar (id integer)"); err != nil {
+    t.Fatal(err)
+  }
+  for i := 0; i < 2; i++ {
+    if _, err = tx.ExecContext(ctx, "insert into bar (id) values (?)", i); err != nil {
+      t.Fatal(err)
+    }
+  }
+  n, err := QueryCount(tx, "select count(*) from bar")
+  if err != nil || n != 2 {
+    t.Fatalf("expected 2 rows in tx, got %d (%v)", n, err)
+  }
+  if db.stmts.ll.Len() != 0 {
+    t.Fatalf("expected no cached statements, got %d", db.stmts.ll.Len())
+  }
+
+  if err = tx.Commit(); err != nil {
+    t.Fatal(err)
+  }
+  if n, err = QueryCount(db, "select count(*) from bar"); err != nil || n != 2 {
+    t.Fatalf("expected 2 rows, got %d (%v)", n, err)
+  }
+}
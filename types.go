@@ -40,3 +40,33 @@ func (nt NullTime) Value() (driver.Value, error) {
   }
   return nt.Time, nil
 }
+
+// Null represents a value of type T that may be NULL. It can be used
+// for any type the driver (or ConvertAssign) can convert into T.
+type Null[T any] struct {
+  V     T
+  Valid bool // Valid is true if V is not NULL
+}
+
+// NewNull returns a valid Null holding v.
+func NewNull[T any](v T) Null[T] {
+  return Null[T]{V: v, Valid: true}
+}
+
+// Scan implements the Scanner interface.
+func (n *Null[T]) Scan(value interface{}) error {
+  if value == nil {
+    n.V, n.Valid = *new(T), false
+    return nil
+  }
+  n.Valid = true
+  return ConvertAssign(&n.V, value)
+}
+
+// Value implements the driver Valuer interface.
+func (n Null[T]) Value() (driver.Value, error) {
+  if !n.Valid {
+    return nil, nil
+  }
+  return driver.DefaultParameterConverter.ConvertValue(n.V)
+}